@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+	"sync"
+)
+
+const (
+	Size = "size"
+)
+
+// An Analyzer is an Effect which passes its input through unchanged, and
+// keeps the most recent window of it, so that its spectrum can be inspected
+// from the REPL. The window is Hann-shaped, and its size (in frames) must
+// be a power of 2.
+type Analyzer struct {
+	simpleEffect
+
+	mtx     sync.Mutex // guards history, which is written on the audio path
+	history []float32  // ring buffer
+	pos     int
+}
+
+func NewAnalyzer(name string) *Analyzer {
+	return &Analyzer{
+		simpleEffect: makeSimpleEffect(name),
+		history:      make([]float32, 4096),
+	}
+}
+
+func NewAnalyzerNode(name string) Node { return Node(NewAnalyzer(name)) }
+
+func (e *Analyzer) String() string {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return fmt.Sprintf("[%s: %d-point]", NodeLabel(e), len(e.history))
+}
+
+func (e *Analyzer) Kind() string { return "Analyzer" }
+
+func (e *Analyzer) processEvent(ev Event) {
+	switch ev.Type {
+	case Size:
+		n := int(ev.Value)
+		if !isPowerOf2(n) || n < 256 || n > 65536 {
+			D("%s: invalid Size %.2f", e.Name(), ev.Value)
+			break
+		}
+		e.mtx.Lock()
+		e.history, e.pos = make([]float32, n), 0
+		e.mtx.Unlock()
+
+	default:
+		e.simpleEffect.processEvent(ev)
+	}
+}
+
+// processAudio satisfies the audioProcessor interface. The buffer is
+// left as it is.
+func (e *Analyzer) processAudio(buf []float32) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for _, v := range buf {
+		e.history[e.pos] = v
+		e.pos = (e.pos + 1) % len(e.history)
+	}
+}
+
+// Spectrum computes the spectrum of the most recent window of audio.
+func (e *Analyzer) Spectrum() Spectrum {
+	e.mtx.Lock()
+	n := len(e.history)
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(float64(e.history[(e.pos+i)%n]), 0)
+	}
+	e.mtx.Unlock()
+
+	sum := 0.0
+	for i := range x {
+		w := hann(i, n)
+		x[i] *= complex(w, 0)
+		sum += w
+	}
+	fft(x)
+
+	s := Spectrum{
+		Node:       e.Name(),
+		SampleRate: config.SampleRate,
+		Size:       n,
+		BinHz:      float64(config.SampleRate) / float64(n),
+		DB:         make([]float64, n/2+1),
+	}
+	for i := range s.DB {
+		// scaled so a full-scale sine reads 0 dB
+		s.DB[i] = amplitude2dB(2 * cmplx.Abs(x[i]) / sum)
+	}
+
+	peak := 1
+	for i := 1; i < n/2; i++ {
+		if s.DB[i] > s.DB[peak] {
+			peak = i
+		}
+	}
+	// parabolic interpolation around the peak bin
+	a, b, c := s.DB[peak-1], s.DB[peak], s.DB[peak+1]
+	p := 0.0
+	if d := a - 2*b + c; d < 0 {
+		p = 0.5 * (a - c) / d
+	}
+	s.PeakHz = (float64(peak) + p) * s.BinHz
+	s.PeakDB = b - 0.25*(a-c)*p
+	return s
+}
+
+//
+//
+//
+
+// spectrumFloor is the lowest level reported in a Spectrum.
+const spectrumFloor = -120.0
+
+// A Spectrum is the magnitude spectrum of a window of audio, in dB relative
+// to full scale. It's marshaled as-is to JSON.
+type Spectrum struct {
+	Node       string    `json:"node"`
+	SampleRate int       `json:"sample_rate"`
+	Size       int       `json:"size"`
+	BinHz      float64   `json:"bin_hz"`
+	PeakHz     float64   `json:"peak_hz"`
+	PeakDB     float64   `json:"peak_db"`
+	DB         []float64 `json:"db"` // per bin, from 0 Hz to Nyquist
+}
+
+func amplitude2dB(a float64) float64 {
+	if a <= 0 {
+		return spectrumFloor
+	}
+	return math.Max(20*math.Log10(a), spectrumFloor)
+}
+
+// report writes the Spectrum to the Output as a bar graph, with one bar per
+// band. Bands are spaced logarithmically from 20 Hz to Nyquist.
+func (s Spectrum) report(o Output) {
+	const (
+		bands  = 24
+		width  = 48
+		lowHz  = 20.0
+		zeroDB = -96.0 // an empty bar
+	)
+	o.Printf("spectrum %s: %d-point, %.1f Hz/bin", s.Node, s.Size, s.BinHz)
+	nyquist := float64(s.SampleRate) / 2
+	ratio := math.Pow(nyquist/lowHz, 1.0/bands)
+	for i := 0; i < bands; i++ {
+		lo, hi := lowHz*math.Pow(ratio, float64(i)), lowHz*math.Pow(ratio, float64(i+1))
+		db := s.band(lo, hi)
+		n := int(width * (db - zeroDB) / -zeroDB)
+		if n < 0 {
+			n = 0
+		} else if n > width {
+			n = width
+		}
+		o.Printf(
+			"%7.0f Hz │%s%s│ %6.1f dB",
+			lo,
+			strings.Repeat("█", n),
+			strings.Repeat(" ", width-n),
+			db,
+		)
+	}
+	o.Printf("peak %.1f Hz, %.1f dB", s.PeakHz, s.PeakDB)
+}
+
+// band returns the highest level of any bin in [lo, hi). If the band is
+// narrower than a bin, it returns the level of the bin containing its
+// center.
+func (s Spectrum) band(lo, hi float64) float64 {
+	db, found := spectrumFloor, false
+	for i := int(math.Ceil(lo / s.BinHz)); i < len(s.DB) && float64(i)*s.BinHz < hi; i++ {
+		db, found = math.Max(db, s.DB[i]), true
+	}
+	if !found {
+		if i := int(math.Floor((lo+hi)/2/s.BinHz + 0.5)); i < len(s.DB) {
+			db = s.DB[i]
+		}
+	}
+	return db
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+)
+
+// An AudioInput is a generator which yields the audio captured by the
+// Engine from its input device (or whatever stands in for it), so that it
+// can be processed by effects and recorded like any other AudioSender.
+//
+// An AudioInput has no parents, and up to 1 child Node in the Field.
+type AudioInput struct {
+	mailbox
+	audioOutput
+
+	nodeName
+	singleChild
+	noParents
+
+	gain   float32
+	gainIn smoothed
+}
+
+func NewAudioInput(name string) *AudioInput {
+	return &AudioInput{
+		audioOutput: makeAudioOutput(),
+		nodeName:    nodeName(name),
+		gain:        1.0,
+		gainIn:      makeSmoothed(1.0),
+	}
+}
+
+func NewAudioInputNode(name string) Node { return Node(NewAudioInput(name)) }
+
+func (n *AudioInput) Kind() string { return "Audio Input" }
+
+func (n *AudioInput) String() string {
+	return fmt.Sprintf("[%s <gain=%.2f Children=%d>]", NodeLabel(n), n.gain, len(n.Children()))
+}
+
+func (n *AudioInput) processEvent(ev Event) {
+	switch ev.Type {
+	case Connect, Disconnect:
+		n.singleChild.processEvent(ev, n)
+
+	case Kill:
+		n.ChildNode = nilNode
+
+	case Gain:
+		n.gain = ev.Value
+		n.gainIn.set(ev.Value)
+	}
+}
+
+// inputProcessors are rendered from the audio captured by the Engine.
+type inputProcessor interface {
+	processInput(in, out []float32)
+}
+
+// processInput satisfies the inputProcessor interface.
+func (n *AudioInput) processInput(in, out []float32) {
+	for i, v := range in {
+		out[i] = v * n.gainIn.next()
+	}
+}
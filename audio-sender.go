@@ -1,6 +1,25 @@
 package main
 
+// An AudioSender yields one buffer of audio data per block. AudioOut returns
+// the buffer rendered by the Engine for the current block. It's owned by the
+// AudioSender, and only valid until the next block is rendered.
+//
+// That's the whole buffer ownership protocol: every AudioSender allocates
+// exactly one buffer when it's created, and renders into it every block.
+// Consumers may read it, but never write to it or keep it; a consumer which
+// needs the data later (eg. a Delay) must copy it into storage of its own,
+// which it also allocates up front. So rendering never allocates.
 type AudioSender interface {
-	AudioOut() <-chan []float32
-	Reset() // stop playback by breaking downstream connections
+	AudioOut() []float32
 }
+
+// audioOutput may be embedded into any type to satisfy
+// the AudioSender interface.
+type audioOutput struct{ out []float32 }
+
+func makeAudioOutput() audioOutput {
+	return audioOutput{make([]float32, config.BufferSize)}
+}
+
+// AudioOut satisfies the AudioSender interface.
+func (ao *audioOutput) AudioOut() []float32 { return ao.out }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// A benchmark renders blocks from a Field, which is built from a script of
+// parser commands. Once the first block has been rendered, rendering must
+// never allocate.
+type benchmark struct {
+	name   string
+	script string
+}
+
+var benchmarks = []benchmark{
+	{
+		"generators",
+		"add sine a; add sine b; add sine c; add modlfo l; add modenv v; " +
+			"mod l a.hz 5; mod v b.gain 0.5; c4 -> a; e4 -> b; g4 -> c; c4 -> v",
+	},
+	{
+		"effects",
+		"add sine a; add gainlfo l; add delay d; add echo e; add adsr v; " +
+			"add analyzer z; add tuner t; a -> l; l -> d; d -> e; e -> v; v -> z; " +
+			"z -> t; t subscribe a; a4 -> a; a4 -> v",
+	},
+	{
+		"input",
+		"add input i; add envfollow f; add delay d; add echo e; add sine s; " +
+			"i -> f; f -> d; d -> e; e -> mixer; f subscribe s",
+	},
+	{
+		"mixer",
+		"add sine a; add sine b; add sine c; add sine d; " +
+			"add sum s; add ringmod r; add crossfade x; " +
+			"a -> s; b -> s; c -> r; d -> r; s -> x; r -> x; " +
+			"a -> mixer; b -> mixer; x -> mixer; " +
+			"a4 -> a; c5 -> b; e5 -> c; a2 -> d",
+	},
+}
+
+// block builds the benchmark's Field, and returns a function rendering one
+// block from it. All Events from the script have been delivered.
+func (bm benchmark) block(tb testing.TB) func() {
+	f := NewField()
+	m := NewMixer()
+	f.Add(m)
+	f.Add(NewClock(f))
+	e := NewEngine(f, m)
+
+	o := &recordingOutput{}
+	NewFieldParser(f, e, o).Parse(bm.script)
+	if o.err != nil {
+		tb.Fatalf("%s: %s", bm.name, o.err)
+	}
+	out := make([]float32, config.BufferSize)
+	block := func() { e.ProcessAudio(nil, out) }
+	block()
+	return block
+}
+
+func (bm benchmark) run(b *testing.B) {
+	block := bm.block(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		block()
+	}
+}
+
+func TestRenderingDoesntAllocate(t *testing.T) {
+	for _, bm := range benchmarks {
+		if allocs := testing.AllocsPerRun(100, bm.block(t)); allocs > 0 {
+			t.Errorf("%s: %.0f allocs/block", bm.name, allocs)
+		}
+	}
+}
+
+func BenchmarkGenerators(b *testing.B) { benchmarks[0].run(b) }
+func BenchmarkEffects(b *testing.B)    { benchmarks[1].run(b) }
+func BenchmarkInput(b *testing.B)      { benchmarks[2].run(b) }
+func BenchmarkMixer(b *testing.B)      { benchmarks[3].run(b) }
+
+// recordingOutput is an Output which discards everything, except the
+// first line which looks like an error.
+type recordingOutput struct{ err error }
+
+func (o *recordingOutput) Print(s string) {
+	o.Printf("%s", s)
+}
+
+func (o *recordingOutput) Printf(format string, args ...interface{}) {
+	s := fmt.Sprintf(format, args...)
+	if o.err == nil && !isOK(s) {
+		o.err = fmt.Errorf("%s", s)
+	}
+}
+
+func isOK(s string) bool {
+	return len(s) >= 2 && s[len(s)-2:] == "OK"
+}
@@ -1,66 +1,458 @@
 package main
 
 import (
-	"time"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 const (
-	Tick = "tick"
-	BPM  = "bpm"
+	Tick    = "tick"
+	BPM     = "bpm"
+	Ramp    = "ramp" // ramp:<length> changes the BPM gradually, over the length
+	PPQN    = "ppqn"
+	TimeSig = "timesig"
 )
 
-func TickEvent(i int, c *Clock) Event { return Event{Tick, float32(i), c} }
+// TickEvent is the i'th Tick of the Clock, which falls at the frame. The
+// Clock gives its musical Position.
+func TickEvent(i int, c *Clock, at int64) Event { return Event{Tick, float32(i), c, at} }
 
+// TimeSigEvent changes the Clock's TimeSignature from its next bar.
+func TimeSigEvent(s TimeSignature) Event { return Event{TimeSig + ":" + s.String(), 0.0, nil, 0} }
+
+// defaultPPQN is the Clock's resolution, unless it's changed: the MIDI
+// clock's.
+const defaultPPQN = 24
+
+// maxPPQN is the Clock's highest resolution.
+const maxPPQN = 960
+
+// The Clock broadcasts Ticks to every Node subscribed to them, PPQN times
+// per quarter note, at its tempo in quarter notes per minute, which follows
+// its tempo map. It keeps time in the Field's timeline, so it's always in
+// step with the audio.
+// Each Tick is broadcast a block ahead, and carries the exact frame of its
+// pulse, so Nodes can act on it at that frame. A Groove moves those frames
+// off the grid.
+//
+// Tick i falls on quarter note i/PPQN. With the time signature, which may
+// change from bar to bar, that gives each Tick a Position in bars, beats
+// and ticks.
 type Clock struct {
 	nodeName
 	noParents
 	noChildren
+	mailbox
+
+	f       *Field
+	stopped bool
 
-	bpm     float32
-	f       Field
-	i       int
-	eventIn chan Event
+	mtx    sync.Mutex    // guards the grid, which is read from the REPL
+	tempos []TempoChange // in order, from beat 0
+	ppqn   int
+	meters []meterChange // in order
+	at     int64         // the frame of beat 0
+	groove *Groove       // or nil, for straight time
+	i      int           // of the next Tick
+	next   int64         // frame of the next Tick; -1 before the first block
 }
 
-func NewClock(f Field) *Clock {
-	c := &Clock{
+// A meterChange is a TimeSignature, and the bar, starting at the beat, from
+// which it applies.
+type meterChange struct {
+	beat float64
+	bar  int
+	sig  TimeSignature
+}
+
+func NewClock(f *Field) *Clock {
+	return &Clock{
 		nodeName: "clock",
-		bpm:      120,
+		tempos:   []TempoChange{{Beat: 0, BPM: 120, from: 120}},
+		ppqn:     defaultPPQN,
+		meters:   []meterChange{{0, 1, TimeSignature{4, 4}}},
 		f:        f,
 		i:        0,
-		eventIn:  make(chan Event),
-	}
-	go c.loop()
-	return c
-}
-
-// Events satisfies the Node interface for Clock
-func (c *Clock) Events() chan<- Event { return c.eventIn }
-
-func (c *Clock) loop() {
-	d := bpm2duration(c.bpm)
-	D("clock operating at %s", d)
-	t := time.NewTicker(bpm2duration(c.bpm))
-	for {
-		select {
-		case <-t.C:
-			go c.f.Broadcast(TickEvent(c.i, c)) // broadcast includes self
-			c.i++
-
-		case ev := <-c.eventIn:
-			switch ev.Type {
-			case BPM:
-				c.bpm = ev.Value
-				t.Stop()
-				t = time.NewTicker(bpm2duration(c.bpm))
-			case Kill:
-				t.Stop()
-				return
-			}
+		next:     -1,
+	}
+}
+
+// Kind satisfies the Typed interface for Clock.
+func (c *Clock) Kind() string { return "Clock" }
+
+// processEvent satisfies the eventProcessor interface for Clock.
+func (c *Clock) processEvent(ev Event) {
+	if strings.HasPrefix(ev.Type, TimeSig+":") {
+		sig, err := ParseTimeSignature(strings.TrimPrefix(ev.Type, TimeSig+":"))
+		if err == nil {
+			err = c.SetTimeSignature(sig)
+		}
+		if err != nil {
+			D("clock: %s", err)
+		}
+		return
+	}
+
+	if strings.HasPrefix(ev.Type, Ramp+":") {
+		l, err := ParseRampLength(strings.TrimPrefix(ev.Type, Ramp+":"))
+		if err != nil || ev.Value <= 0.0 {
+			D("clock: invalid ramp %s to %.2f BPM", ev.Type, ev.Value)
+			return
 		}
+		c.mtx.Lock()
+		beat := c.liveBeat()
+		c.setTempo(TempoChange{Beat: beat, BPM: ev.Value, Ramp: c.rampBeats(beat, l)}, true)
+		c.mtx.Unlock()
+		D("clock ramping to %.2f BPM over %s", ev.Value, l)
+		return
+	}
+
+	switch ev.Type {
+	case BPM:
+		if ev.Value <= 0.0 {
+			D("clock: invalid BPM %.2f", ev.Value)
+			break
+		}
+		c.mtx.Lock()
+		c.setTempo(TempoChange{Beat: c.liveBeat(), BPM: ev.Value}, true)
+		c.mtx.Unlock()
+		D("clock operating at %.2f frames per beat", beatFrames(ev.Value))
+
+	case PPQN:
+		if err := c.SetPPQN(int(ev.Value)); err != nil {
+			D("clock: %s", err)
+		}
+
+	case Kill:
+		c.stopped = true
+	}
+}
+
+// advance satisfies the clocked interface for Clock. It's called at the end
+// of each block, and broadcasts the Ticks falling in the following one.
+func (c *Clock) advance(frames int) {
+	if c.stopped {
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := c.f.Now() // the start of the block just rendered
+	if c.next < 0 {
+		c.at = now + int64(beatFrames(c.tempos[0].from))
+		c.next = c.tickFrame(c.i)
+	}
+	for horizon := now + 2*int64(frames); ; c.i++ {
+		straight := c.next
+		if c.groove != nil {
+			straight = c.pulseFrame(c.i)
+		}
+		if c.next >= horizon && straight >= horizon {
+			break
+		}
+		c.f.broadcastTick(c, TickEvent(c.i, c, c.next), straight)
+		c.next = c.tickFrame(c.i + 1)
 	}
 }
 
-func bpm2duration(bpm float32) time.Duration {
-	return time.Duration(float32(time.Minute) / bpm)
+// beatFrames returns the length of a quarter note at the tempo.
+func beatFrames(bpm float32) float64 {
+	return float64(config.SampleRate*60) / float64(bpm)
+}
+
+// pulseFrame returns the frame of Tick i. The caller must hold the lock.
+func (c *Clock) pulseFrame(i int) int64 {
+	return c.frame(float64(i) / float64(c.ppqn))
+}
+
+// origin returns the frame of beat 0: before the first block, it's a beat
+// from now. The caller must hold the lock.
+func (c *Clock) origin() float64 {
+	if c.next < 0 {
+		return float64(c.f.Now()) + beatFrames(c.tempos[0].from)
+	}
+	return float64(c.at)
+}
+
+// beatAt returns the beat of the frame. The caller must hold the lock.
+func (c *Clock) beatAt(frame int64) float64 {
+	x := float64(frame) - c.origin()
+	i := len(c.tempos) - 1
+	for i > 0 && c.tempos[i].offset > x {
+		i--
+	}
+	t := c.tempos[i]
+	return t.Beat + t.beats((x-t.offset)/float64(config.SampleRate))
+}
+
+// frame returns the frame of the beat. The caller must hold the lock.
+func (c *Clock) frame(beat float64) int64 {
+	t := c.tempos[c.tempoIndex(beat)]
+	x := c.origin() + t.offset + t.seconds(beat)*float64(config.SampleRate)
+	return int64(math.Floor(x + 0.5))
+}
+
+// Beat returns the position of the frame, in quarter notes, on the Clock's
+// grid: Tick i falls on beat i/PPQN. Following the tempo map, beats may be
+// fractional, and in the past or the future.
+func (c *Clock) Beat(frame int64) float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.beatAt(frame)
+}
+
+// Frame returns the frame of the position, in quarter notes, on the
+// Clock's grid. It's the inverse of Beat.
+func (c *Clock) Frame(beat float64) int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.frame(beat)
+}
+
+// BPM returns the Clock's tempo at its next Tick, in quarter notes per
+// minute.
+func (c *Clock) BPM() float32 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.tempoAt(float64(c.i) / float64(c.ppqn))
+}
+
+func bpm2frames(bpm float32) int {
+	return int(float32(config.SampleRate*60) / bpm)
+}
+
+//
+//
+//
+
+// A Position is a point in musical time: a bar, a beat of the bar, as
+// counted by the time signature, and a tick of the beat, at the Clock's
+// PPQN. Bars and beats are counted from 1, and ticks from 0.
+type Position struct {
+	Bar, Beat, Tick int
+}
+
+func (p Position) String() string { return fmt.Sprintf("%d:%d:%d", p.Bar, p.Beat, p.Tick) }
+
+// ParsePosition parses a Position, written as <bar>:<beat>:<tick>. The
+// tick may be omitted.
+func ParsePosition(s string) (Position, error) {
+	toks := strings.Split(s, ":")
+	if len(toks) < 2 || len(toks) > 3 {
+		return Position{}, fmt.Errorf("expected <bar>:<beat>[:<tick>]")
+	}
+	n := [3]int{}
+	for i, tok := range toks {
+		v, err := strconv.Atoi(tok)
+		if err != nil || v < 0 || (i < 2 && v < 1) {
+			return Position{}, fmt.Errorf("invalid position %s", s)
+		}
+		n[i] = v
+	}
+	return Position{n[0], n[1], n[2]}, nil
+}
+
+// A TimeSignature gives the number of beats in a bar, and the note value
+// of each beat, eg. 7/8 is seven eighth notes.
+type TimeSignature struct {
+	Num, Den int
+}
+
+func (s TimeSignature) String() string { return fmt.Sprintf("%d/%d", s.Num, s.Den) }
+
+// ParseTimeSignature parses a TimeSignature, written eg. 7/8. The note
+// value may be a whole note, or a half, quarter, eighth, sixteenth or
+// thirty-second.
+func ParseTimeSignature(s string) (TimeSignature, error) {
+	toks := strings.Split(s, "/")
+	if len(toks) != 2 {
+		return TimeSignature{}, fmt.Errorf("expected <beats>/<note value>")
+	}
+	num, err := strconv.Atoi(toks[0])
+	if err != nil || num < 1 || num > 64 {
+		return TimeSignature{}, fmt.Errorf("invalid beats per bar %s", toks[0])
+	}
+	den, err := strconv.Atoi(toks[1])
+	if err != nil || !isNoteValue(den) {
+		return TimeSignature{}, fmt.Errorf("invalid note value %s", toks[1])
+	}
+	return TimeSignature{num, den}, nil
+}
+
+// isNoteValue returns true for a whole note (1), and its halves, down to
+// a thirty-second (32).
+func isNoteValue(n int) bool {
+	return n >= 1 && n <= 32 && n&(n-1) == 0
+}
+
+// noteTicks returns the length of a note value, in Ticks at the PPQN, or 0 if
+// it doesn't fall on a whole Tick.
+func noteTicks(value, ppqn int) int {
+	if (4*ppqn)%value != 0 {
+		return 0
+	}
+	return 4 * ppqn / value
+}
+
+// beats returns the length of a beat, and of a bar, in quarter notes.
+func (s TimeSignature) beats() (float64, float64) {
+	beat := 4.0 / float64(s.Den)
+	return beat, beat * float64(s.Num)
+}
+
+// meterAt returns the meterChange in effect at the beat. The caller must
+// hold the lock.
+func (c *Clock) meterAt(beat float64) meterChange {
+	m := c.meters[0]
+	for _, other := range c.meters[1:] {
+		if other.beat > beat {
+			break
+		}
+		m = other
+	}
+	return m
+}
+
+// position returns the Position of Tick i. The caller must hold the lock.
+func (c *Clock) position(i int) Position {
+	m := c.meterAt(float64(i) / float64(c.ppqn))
+	beat := noteTicks(m.sig.Den, c.ppqn)
+	bar := beat * m.sig.Num
+	ticks := i - int(math.Floor(m.beat*float64(c.ppqn)+0.5))
+	bars := ticks / bar
+	if ticks < 0 && ticks%bar != 0 {
+		bars-- // floor
+	}
+	ticks -= bars * bar
+	return Position{m.bar + bars, ticks/beat + 1, ticks % beat}
+}
+
+// Position returns the Position of the Tick at or before the frame.
+func (c *Clock) Position(frame int64) Position {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.position(int(math.Floor(c.beatAt(frame) * float64(c.ppqn))))
+}
+
+// BeatPosition returns the Position of the Tick at or before the beat, in
+// quarter notes.
+func (c *Clock) BeatPosition(beat float64) Position {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.position(int(math.Floor(beat*float64(c.ppqn) + 1e-9)))
+}
+
+// AlignBeat returns the first beat, at or after the beat after, which falls
+// as far into its bar as beat does.
+func (c *Clock) AlignBeat(beat, after float64) float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	m := c.meterAt(beat)
+	_, bar := m.sig.beats()
+	into := math.Mod(beat-m.beat, bar)
+	if into < 0 {
+		into += bar
+	}
+	m = c.meterAt(after)
+	_, bar = m.sig.beats()
+	aligned := m.beat + math.Floor((after-m.beat)/bar)*bar + math.Min(into, bar)
+	if aligned < after {
+		aligned += bar
+	}
+	return aligned
+}
+
+// TickPosition returns the Position of the Tick Event.
+func (c *Clock) TickPosition(ev Event) Position {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.position(int(ev.Value))
+}
+
+// PositionBeat returns the position, in quarter notes, of the Position.
+// It's the inverse of Position.
+func (c *Clock) PositionBeat(p Position) float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.positionBeat(p)
+}
+
+// positionBeat returns the position of the Position, in quarter notes. The
+// caller must hold the lock.
+func (c *Clock) positionBeat(p Position) float64 {
+	m := c.meters[0]
+	for _, other := range c.meters[1:] {
+		if other.bar > p.Bar {
+			break
+		}
+		m = other
+	}
+	beat, bar := m.sig.beats()
+	return m.beat + float64(p.Bar-m.bar)*bar + float64(p.Beat-1)*beat + float64(p.Tick)/float64(c.ppqn)
+}
+
+// PPQN returns the Clock's resolution, in Ticks per quarter note.
+func (c *Clock) PPQN() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.ppqn
+}
+
+// SetPPQN changes the Clock's resolution from the next Tick. Every beat of
+// every time signature in use must still fall on a whole Tick.
+func (c *Clock) SetPPQN(ppqn int) error {
+	if ppqn < 1 || ppqn > maxPPQN {
+		return fmt.Errorf("invalid PPQN %d", ppqn)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, m := range c.meters {
+		if noteTicks(m.sig.Den, ppqn) <= 0 {
+			return fmt.Errorf("%d PPQN can't count %s", ppqn, m.sig)
+		}
+	}
+	// Tick numbers are renumbered, so that Tick i still falls on beat
+	// i/PPQN; Ticks already broadcast stay as they were.
+	last := float64(c.i-1) / float64(c.ppqn)
+	c.ppqn = ppqn
+	c.i = int(math.Floor(last*float64(ppqn))) + 1
+	if c.next >= 0 {
+		c.next = c.tickFrame(c.i)
+	}
+	return nil
+}
+
+// TimeSignature returns the TimeSignature of the current bar.
+func (c *Clock) TimeSignature() TimeSignature {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.meterAt(float64(c.i) / float64(c.ppqn)).sig
+}
+
+// SetTimeSignature changes the Clock's TimeSignature from the start of the
+// next bar, or the current one, if its first Tick is yet to come.
+func (c *Clock) SetTimeSignature(sig TimeSignature) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if noteTicks(sig.Den, c.ppqn) <= 0 {
+		return fmt.Errorf("%d PPQN can't count %s", c.ppqn, sig)
+	}
+	p := c.position(c.i)
+	m := c.meterAt(float64(c.i) / float64(c.ppqn))
+	if p.Beat != 1 || p.Tick != 0 {
+		p.Bar++
+	}
+	_, bar := m.sig.beats()
+	change := meterChange{m.beat + float64(p.Bar-m.bar)*bar, p.Bar, sig}
+
+	meters := c.meters[:0]
+	for _, other := range c.meters {
+		if other.beat < change.beat {
+			meters = append(meters, other)
+		}
+	}
+	c.meters = append(meters, change)
+	return nil
 }
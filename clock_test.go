@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseTimeSignature(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want TimeSignature
+		ok   bool
+	}{
+		{"4/4", TimeSignature{4, 4}, true},
+		{"7/8", TimeSignature{7, 8}, true},
+		{"1/1", TimeSignature{1, 1}, true},
+		{"64/32", TimeSignature{64, 32}, true},
+		{"3/6", TimeSignature{}, false},
+		{"0/4", TimeSignature{}, false},
+		{"65/4", TimeSignature{}, false},
+		{"4/64", TimeSignature{}, false},
+		{"4", TimeSignature{}, false},
+		{"4/4/4", TimeSignature{}, false},
+	} {
+		got, err := ParseTimeSignature(tc.s)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("%s: %s, %v", tc.s, got, err)
+		}
+	}
+}
+
+func TestNoteTicks(t *testing.T) {
+	for _, tc := range []struct {
+		value, ppqn, want int
+	}{
+		{4, 24, 24},
+		{8, 24, 12},
+		{1, 24, 96},
+		{32, 24, 3},
+		{32, 4, 0}, // half a Tick
+		{16, 4, 1},
+		{2, 1, 2},
+	} {
+		if got := noteTicks(tc.value, tc.ppqn); got != tc.want {
+			t.Errorf("1/%d at %d PPQN: %d Ticks, want %d", tc.value, tc.ppqn, got, tc.want)
+		}
+	}
+}
+
+// A meterAfter changes the time signature after a number of bars.
+type meterAfter struct {
+	bars int
+	sig  TimeSignature
+}
+
+// meteredClock returns a Clock at the PPQN, whose time signature changes
+// as given, from 4/4.
+func meteredClock(t *testing.T, ppqn int, changes ...meterAfter) *Clock {
+	c := NewClock(NewField())
+	if err := c.SetPPQN(ppqn); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range changes {
+		sig := c.meters[len(c.meters)-1].sig
+		c.i += m.bars * sig.Num * noteTicks(sig.Den, ppqn)
+		if err := c.SetTimeSignature(m.sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestClockPositions(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		clock *Clock
+		tick  int
+		want  Position
+	}{
+		{"4/4", meteredClock(t, 24), 0, Position{1, 1, 0}},
+		{"4/4", meteredClock(t, 24), 25, Position{1, 2, 1}},
+		{"4/4", meteredClock(t, 24), 96, Position{2, 1, 0}},
+		{"4/4", meteredClock(t, 24), -1, Position{0, 4, 23}},
+		{"4/4 at 960", meteredClock(t, 960), 3*3840 + 960 + 7, Position{4, 2, 7}},
+		{"6/8", meteredClock(t, 24, meterAfter{0, TimeSignature{6, 8}}), 72, Position{2, 1, 0}},
+		{"6/8", meteredClock(t, 24, meterAfter{0, TimeSignature{6, 8}}), 84, Position{2, 2, 0}},
+		{"6/8", meteredClock(t, 24, meterAfter{0, TimeSignature{6, 8}}), 143, Position{2, 6, 11}},
+		{"4/4 then 7/8", meteredClock(t, 24, meterAfter{1, TimeSignature{7, 8}}), 95, Position{1, 4, 23}},
+		{"4/4 then 7/8", meteredClock(t, 24, meterAfter{1, TimeSignature{7, 8}}), 96, Position{2, 1, 0}},
+		{"4/4 then 7/8", meteredClock(t, 24, meterAfter{1, TimeSignature{7, 8}}), 96 + 84, Position{3, 1, 0}},
+		{"4/4, 7/8, 3/2", meteredClock(t, 24, meterAfter{1, TimeSignature{7, 8}}, meterAfter{2, TimeSignature{3, 2}}), 96 + 168 + 48, Position{4, 2, 0}},
+	} {
+		c := tc.clock
+		if got := c.position(tc.tick); got != tc.want {
+			t.Errorf("%s: Tick %d at %s, want %s", tc.name, tc.tick, got, tc.want)
+		}
+		beat := c.PositionBeat(tc.want)
+		if want := float64(tc.tick) / float64(c.ppqn); math.Abs(beat-want) > 1e-9 {
+			t.Errorf("%s: %s on beat %g, want %g", tc.name, tc.want, beat, want)
+		}
+		if got := c.BeatPosition(beat); got != tc.want {
+			t.Errorf("%s: beat %g at %s, want %s", tc.name, beat, got, tc.want)
+		}
+	}
+}
+
+func TestSetPPQN(t *testing.T) {
+	c := meteredClock(t, 24)
+	for _, ppqn := range []int{0, -1, maxPPQN + 1} {
+		if c.SetPPQN(ppqn) == nil {
+			t.Errorf("accepted %d PPQN", ppqn)
+		}
+	}
+
+	c = meteredClock(t, 4, meterAfter{0, TimeSignature{7, 16}})
+	if c.SetPPQN(2) == nil {
+		t.Error("2 PPQN can't count sixteenths")
+	}
+	if c.SetTimeSignature(TimeSignature{3, 32}) == nil {
+		t.Error("4 PPQN can't count thirty-seconds")
+	}
+
+	// renumbered, so that the next Tick follows the last one
+	for _, tc := range []struct{ from, to, next int }{
+		{24, 96, 47*4 + 1},
+		{96, 24, 47/4 + 1},
+		{24, 7, 47*7/24 + 1},
+	} {
+		c := meteredClock(t, tc.from)
+		c.i = 48
+		if err := c.SetPPQN(tc.to); err != nil {
+			t.Fatal(err)
+		}
+		if c.i != tc.next {
+			t.Errorf("%d to %d PPQN: next Tick %d, want %d", tc.from, tc.to, c.i, tc.next)
+		}
+	}
+}
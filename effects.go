@@ -2,145 +2,44 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
-// effectChannels are designed to be embedded into simple effects,
-// which should accept exactly one input audio channel, manipulate it
-// somehow, and provide the manipulated output on exactly one output
-// audio channel. Simple effects should also respond to (at minimum)
-// a certain subset of Events, so effectChannels also implements the
-// EventReceiver interface, and handles a subset of Event types itself.
-type effectChannels struct {
-	eventIn  chan Event
-	audioIn  <-chan []float32
-	audioOut chan []float32
-}
-
-func makeEffectChannels() effectChannels {
-	return effectChannels{
-		eventIn: make(chan Event, EVENT_CHAN_BUFFER),
-		// audioIn initially nil
-		audioOut: make(chan []float32, AUDIO_CHAN_BUFFER),
-	}
-}
-
-// Events() satisfies the Node interface.
-func (ec *effectChannels) Events() chan<- Event {
-	return ec.eventIn
-}
-
-// AudioOut() satisfies the AudioSender interface.
-func (ec *effectChannels) AudioOut() <-chan []float32 {
-	return ec.audioOut
-}
-
-// Reset() satisfies the AudioSender interface.
-func (ec *effectChannels) Reset() {
-	close(ec.audioOut)
-	ec.audioOut = make(chan []float32, AUDIO_CHAN_BUFFER)
-}
-
-// The important thing to consider here is how data flows through the network.
-// It's a pull-based system. Audio producers will happily produce as much data
-// as they can cram into their output channels. The consumer at the end of the
-// data chain (ie. the mixer) is ultimately responsible for draining the
-// channels. So, it controls the rate at which audio data should be produced.
-//
-// How do we handle disconnections? Specifically, when a disconnect signal is
-// sent to a module, it closes its audio output channels, and re-creates them.
-// How will that be signaled to downstream receivers? Detecting a channel close
-// is simple enough, on the receiving end:
-//
-//     buf, ok := <-audioIn
-//     if !ok {
-//	       // closed
-//     }
-//
-// But that implies that checking if a channel is closed will yield actual data
-// if it's not. We don't want that behavior. So, receivers need to throttle
-// their channel-drains to at most one per every available slot in their
-// downstream channel-fills. The simple way to do that is to buffer one
-// []float32 in each module.
-//
-//     var buf []float32 = nil
-//     for {
-//         if buf == nil {
-//             buf := <-audioIn
-//             process(buf)
-//         }
-//         select {
-//         case audioOut <-buf:
-//             buf = nil
-//         case ev := <-eventIn:
-//             process(ev)
-//         }
-//     }
-//
-// Should work...
-
+// simpleEffects are designed to be embedded into effects which accept
+// exactly one input audio stream, manipulate it somehow, and provide the
+// manipulated output as exactly one output audio stream. Simple effects
+// should also respond to (at minimum) a certain subset of Events, so
+// simpleEffect handles a subset of Event types itself.
 type simpleEffect struct {
 	nodeName
 	singleAncestry
-	effectChannels
+	mailbox
+	audioOutput
 }
 
 func makeSimpleEffect(name string) simpleEffect {
 	return simpleEffect{
-		nodeName:       nodeName(name),
-		effectChannels: makeEffectChannels(),
+		nodeName:    nodeName(name),
+		audioOutput: makeAudioOutput(),
 	}
 }
 
-func (se *simpleEffect) loop(ep eventProcessor, ap audioProcessor) {
-	var buf []float32 = nil
-	for {
-		// as described above: buffer exactly 1 audio buffer locally
-		var ok bool = false
-		if se.effectChannels.audioIn != nil && buf == nil {
-			if buf, ok = <-se.effectChannels.audioIn; ok {
-				ap.processAudio(buf)
-			} else {
-				se.effectChannels.audioIn = nil // closed
-			}
+// processEvent handles the Event types common to all simple effects.
+// Concrete effects should pass any Events they don't handle themselves
+// down to it.
+func (se *simpleEffect) processEvent(ev Event) {
+	switch ev.Type {
+	case Connection: // upstream
+		if _, senderOk := ev.Arg.(AudioSender); !senderOk {
+			D("simpleEffect got Connection from non-AudioSender")
+			break
 		}
+		se.singleAncestry.processEvent(ev, se)
 
-		select {
-		case ev := <-se.effectChannels.eventIn:
-			switch ev.Type {
-			case Connect:
-				// nothing to do re: audio channels, really
-				se.singleAncestry.processEvent(ev, se)
-
-			case Disconnect:
-				se.effectChannels.Reset()
-				se.singleAncestry.processEvent(ev, se)
-
-			case Connection: // upstream
-				sender, senderOk := ev.Arg.(AudioSender)
-				if !senderOk {
-					D("simpleEffect got Connection from non-AudioSender")
-					break
-				}
-				se.effectChannels.audioIn = sender.AudioOut()
-				se.singleAncestry.processEvent(ev, se)
-
-			case Disconnection: // upstream
-				// nothing to do re: audio channels, really
-				se.singleAncestry.processEvent(ev, se)
-
-			case Kill:
-				se.effectChannels.Reset()
-				se.singleAncestry.processEvent(ev, se)
-				return
-
-			default:
-				ep.processEvent(ev)
-			}
-
-		case se.effectChannels.audioOut <- buf:
-			buf = nil // need a new one, now
-		}
+	case Connect, Disconnect, Disconnection, Kill:
+		se.singleAncestry.processEvent(ev, se)
 	}
 }
 
@@ -159,11 +58,14 @@ type audioProcessor interface {
 // from min to max at a rate of hz.
 type GainLFO struct {
 	simpleEffect
+	modulated
 
 	min   float32
 	max   float32
 	hz    float32
 	phase float32
+
+	minIn, maxIn, hzIn smoothed // in effect
 }
 
 func NewGainLFO(name string) *GainLFO {
@@ -174,8 +76,11 @@ func NewGainLFO(name string) *GainLFO {
 		max:   1.0,
 		hz:    1.0,
 		phase: 0.0,
+
+		minIn: makeSmoothed(0.0),
+		maxIn: makeSmoothed(1.0),
+		hzIn:  makeSmoothed(1.0),
 	}
-	go e.simpleEffect.loop(e, e)
 	return e
 }
 
@@ -198,14 +103,29 @@ func (e *GainLFO) processEvent(ev Event) {
 		e.max = ev.Value
 	case "hz":
 		e.hz = ev.Value
+	case Modulate:
+		e.modulate(ev)
+	default:
+		e.simpleEffect.processEvent(ev)
 	}
 }
 
+// modulatable satisfies the modulatable interface.
+func (e *GainLFO) modulatable() []string { return []string{"min", "max", Hz} }
+
 // GainLFO's processAudio changes the amplitude of the buffer.
 func (e *GainLFO) processAudio(buf []float32) {
+	e.minIn.set(e.min + e.offset("min"))
+	e.maxIn.set(e.max + e.offset("max"))
+	hz := e.hz + e.offset(Hz)
+	if hz < 0.0 {
+		hz = 0.0
+	}
+	e.hzIn.set(hz)
 	for i, v := range buf {
-		raw := nextGeneratorFunctionValue(sine, e.hz, &e.phase)
-		mod := ((e.max - e.min) * raw) + e.min
+		min, max := e.minIn.next(), e.maxIn.next()
+		raw := nextGeneratorFunctionValue(sine, e.hzIn.next(), &e.phase)
+		mod := ((max - min) * raw) + min
 		buf[i] = mod * v
 	}
 }
@@ -214,25 +134,26 @@ func (e *GainLFO) processAudio(buf []float32) {
 //
 //
 
-// The Delay is an Effect which buffers incoming audio data for (approximately)
-// delay seconds before sending it out the outgoing audio channel.
+// The Delay is an Effect which buffers incoming audio data for
+// delay seconds before sending it downstream. The delay may be modulated
+// anywhere between 0 and twice its set value. Its history holds twice
+// maxDelay seconds from the start, so that changing the delay only moves
+// where it's read from.
 type Delay struct {
 	simpleEffect
+	modulated
 
-	history chan []float32
+	history []float32 // ring buffer
+	pos     int
 	delay   float32
+	frames  float32 // delay in effect, including modulation
 }
 
 func NewDelay(name string) *Delay {
-	initialDelay := float32(1.0) // sec
-	depth := int64((SRATE * initialDelay) / BUFSZ)
 	e := &Delay{
 		simpleEffect: makeSimpleEffect(name),
-
-		history: make(chan []float32, depth),
-		delay:   initialDelay,
 	}
-	go e.simpleEffect.loop(e, e)
+	e.setDelay(1.0) // sec
 	return e
 }
 
@@ -250,28 +171,70 @@ const (
 	LoopDelay = "loopdelay"
 )
 
+// maxDelay is the longest delay, in seconds, a Delay may be set to.
+const maxDelay = 5.0
+
 // Delay's processEvent manages changes to the delay parameter.
 func (e *Delay) processEvent(ev Event) {
 	switch ev.Type {
 	case LoopDelay:
-		e.delay = ev.Value
-		depth := int64((SRATE * e.delay) / BUFSZ)
-		e.history = make(chan []float32, depth)
+		if ev.Value >= 0.0 && ev.Value <= maxDelay {
+			e.setDelay(ev.Value)
+		}
+	case Modulate:
+		e.modulate(ev)
+	default:
+		e.simpleEffect.processEvent(ev)
+	}
+}
+
+// modulatable satisfies the modulatable interface.
+func (e *Delay) modulatable() []string { return []string{"delay"} }
+
+// setDelay sets the delay, which must be at most maxDelay. The history is
+// allocated the first time; after that, it's kept, so that the Delay goes
+// on from the audio it already holds.
+func (e *Delay) setDelay(delay float32) {
+	if e.history == nil {
+		e.history = make([]float32, 2*int(float32(config.SampleRate)*maxDelay)+2)
 	}
+	e.delay = delay
+	e.modulateDelay()
+}
+
+// modulateDelay computes the delay in effect for the next block.
+func (e *Delay) modulateDelay() {
+	e.frames = (e.delay + e.offset("delay")) * float32(config.SampleRate)
+	if max := 2 * e.delay * float32(config.SampleRate); e.frames > max {
+		e.frames = max
+	}
+	if max := float32(len(e.history) - 2); e.frames > max {
+		e.frames = max
+	}
+	if e.frames < 0.0 {
+		e.frames = 0.0
+	}
+}
+
+// next pushes the value into the history, and pops the value which was
+// pushed the delay in effect ago, interpolating between frames.
+func (e *Delay) next(val float32) float32 {
+	n := len(e.history)
+	if n < 2 {
+		return val
+	}
+	e.history[e.pos] = val
+	i := int(e.frames)
+	frac := e.frames - float32(i)
+	a, b := e.history[(e.pos-i+n)%n], e.history[(e.pos-i-1+n)%n]
+	e.pos = (e.pos + 1) % n
+	return a + (b-a)*frac
 }
 
 func (e *Delay) processAudio(buf []float32) {
-	select {
-	case e.history <- buf:
-		// not yet full, so we shouldn't output anything
-		for i, _ := range buf {
-			buf[i] = 0.0
-		}
-	default:
-		// full, so pop + push
-		outBuf := <-e.history
-		e.history <- buf
-		buf = outBuf
+	e.modulateDelay()
+	for i, val := range buf {
+		buf[i] = e.next(val)
 	}
 }
 
@@ -282,21 +245,19 @@ func (e *Delay) processAudio(buf []float32) {
 // An Echo is just a Delay with different processAudio logic.
 type Echo struct {
 	Delay
-	wet float32 // 0..1
+	wet   float32 // 0..1
+	wetIn smoothed
 }
 
 func NewEcho(name string) *Echo {
-	initialDelay := float32(1.0) // sec
-	depth := int64((SRATE * initialDelay) / BUFSZ)
 	e := &Echo{
 		Delay: Delay{
 			simpleEffect: makeSimpleEffect(name),
-			history:      make(chan []float32, depth),
-			delay:        initialDelay,
 		},
-		wet: 0.5,
+		wet:   0.5,
+		wetIn: makeSmoothed(0.5),
 	}
-	go e.simpleEffect.loop(e, e)
+	e.setDelay(1.0) // sec
 	return e
 }
 
@@ -321,157 +282,296 @@ func (e *Echo) processEvent(ev Event) {
 	}
 }
 
+// modulatable satisfies the modulatable interface.
+func (e *Echo) modulatable() []string { return []string{"delay", "wet"} }
+
 func (e *Echo) processAudio(buf []float32) {
-	select {
-	case e.history <- buf:
-		// not yet full, so we shouldn't output anything
-		break
+	e.modulateDelay()
+	e.wetIn.set(clamp01(e.wet + e.offset("wet")))
+	for i, val := range buf {
+		wet := e.wetIn.next()
+		buf[i] = (wet * val) + (e.next(val) * (1 - wet))
+	}
+}
+
+//
+//
+//
+
+const (
+	Attack   = "attack"
+	Decay    = "decay"
+	Sustain  = "sustain"
+	Release  = "release"
+	Curve    = "curve"
+	VelScale = "velscale"
+)
+
+// CurveEvent sets the shape of an ADSR's stages: linear or exponential.
+// From the REPL, it may be written as eg. curve:exp.
+func CurveEvent(curve string) Event { return Event{Curve + ":" + curve, 0.0, nil, 0} }
+
+type adsrStage int
+
+const (
+	adsrIdle adsrStage = iota
+	adsrAttack
+	adsrDecay
+	adsrSustain
+	adsrRelease
+)
+
+// Target ratios determine the curvature of the envelope: each stage
+// approaches a target which overshoots its end level by ratio × peak, and
+// ends when it reaches the end level. Large ratios are effectively linear.
+// http://www.earlevel.com/main/2013/06/03/envelope-generators-adsr-code/
+const (
+	linearRatio       = 1000.0
+	attackRatio       = 0.3
+	decayReleaseRatio = 0.0001
+)
+
+// An envelope generates an attack-decay-sustain-release curve, one frame
+// at a time. It's gated by Events: KeyDown starts the attack from the
+// current level, and KeyUp starts the release.
+//
+// Attack, Decay and Release Events set stage durations in milliseconds
+// (or via a time.Duration Arg), and Sustain sets the sustain level in
+// [0 .. 1]. If the KeyDown Note has a velocity, the peak level is scaled by
+// it, according to VelScale: 0 ignores velocity, and 1 scales fully.
+type envelope struct {
+	attack   time.Duration
+	decay    time.Duration
+	sustain  float32
+	release  time.Duration
+	linear   bool
+	velScale float32
+
+	stage adsrStage
+	peak  float64
+	level float64
+	coef  float64 // level = level*coef + base, each frame
+	base  float64
+}
+
+func makeEnvelope() envelope {
+	return envelope{
+		attack:   50 * time.Millisecond,
+		decay:    50 * time.Millisecond,
+		sustain:  0.8,
+		release:  100 * time.Millisecond,
+		linear:   true,
+		velScale: 1.0,
+
+		stage: adsrIdle,
+	}
+}
+
+func (e *envelope) String() string {
+	curve := "exp"
+	if e.linear {
+		curve = "linear"
+	}
+	return fmt.Sprintf("%s/%s/%.2f/%s %s", e.attack, e.decay, e.sustain, e.release, curve)
+}
+
+// processEvent applies Events which gate or shape the envelope.
+func (e *envelope) processEvent(ev Event) {
+	if strings.HasPrefix(ev.Type, Curve+":") {
+		switch strings.TrimPrefix(ev.Type, Curve+":") {
+		case "linear", "lin":
+			e.linear = true
+		case "exponential", "exp":
+			e.linear = false
+		default:
+			D("envelope: invalid %s", ev.Type)
+		}
+		return
+	}
+
+	switch ev.Type {
+	case KeyDown:
+		vel := float32(1.0)
+		if n, ok := ev.Arg.(velocityNote); ok {
+			vel = n.Velocity()
+		}
+		e.peak = float64(1.0 - e.velScale*(1.0-vel))
+		e.enter(adsrAttack)
+
+	case KeyUp:
+		if e.stage != adsrIdle {
+			e.enter(adsrRelease)
+		}
+
+	case Attack:
+		e.attack = eventDuration(ev, e.attack)
+	case Decay:
+		e.decay = eventDuration(ev, e.decay)
+	case Release:
+		e.release = eventDuration(ev, e.release)
+
+	case Sustain:
+		if ev.Value >= 0.0 && ev.Value <= 1.0 {
+			e.sustain = ev.Value
+		}
+
+	case VelScale:
+		if ev.Value >= 0.0 && ev.Value <= 1.0 {
+			e.velScale = ev.Value
+		}
+	}
+}
+
+// eventDuration returns the duration carried by the Event: its Arg, if
+// that's a time.Duration, or else its Value in milliseconds. Negative
+// durations are invalid, and leave the current duration d.
+func eventDuration(ev Event, d time.Duration) time.Duration {
+	if arg, ok := ev.Arg.(time.Duration); ok {
+		if arg >= 0 {
+			return arg
+		}
+		return d
+	}
+	if ev.Value >= 0.0 {
+		return time.Duration(float64(ev.Value) * float64(time.Millisecond))
+	}
+	return d
+}
+
+// enter begins the stage, computing its per-frame coefficients so that it
+// gets from the current level to its end level in exactly its duration.
+func (e *envelope) enter(stage adsrStage) {
+	e.stage = stage
+	ratio, d, end, dir := decayReleaseRatio, time.Duration(0), 0.0, -1.0
+	switch stage {
+	case adsrAttack:
+		ratio, d, end, dir = attackRatio, e.attack, e.peak, 1.0
+	case adsrDecay:
+		d, end = e.decay, float64(e.sustain)*e.peak
+	case adsrRelease:
+		d = e.release
 	default:
-		outBuf := <-e.history // pop
-		e.history <- buf      // push
-		if len(buf) != len(outBuf) {
-			break
+		return
+	}
+	if e.linear {
+		ratio = linearRatio
+	}
+	target := end + dir*ratio*math.Max(e.peak, 0.001)
+
+	span := (target - e.level) / (target - end)
+	if span <= 1.0 { // already there
+		e.coef, e.base = 0.0, end
+		return
+	}
+	frames := math.Max(d.Seconds()*float64(config.SampleRate), 1.0)
+	e.coef = math.Exp(-math.Log(span) / frames)
+	e.base = target * (1.0 - e.coef)
+}
+
+// next advances the envelope by one frame, and returns its level.
+func (e *envelope) next() float32 {
+	switch e.stage {
+	case adsrAttack:
+		if e.level = e.level*e.coef + e.base; e.level >= e.peak {
+			e.level = e.peak
+			e.enter(adsrDecay)
 		}
-		for i, val := range buf {
-			buf[i] = (e.wet * val) + (outBuf[i] * (1 - e.wet))
+
+	case adsrDecay:
+		sustain := float64(e.sustain) * e.peak
+		if e.level = e.level*e.coef + e.base; e.level <= sustain {
+			e.level = sustain
+			e.stage = adsrSustain
+		}
+
+	case adsrRelease:
+		if e.level = e.level*e.coef + e.base; e.level <= 0.0 {
+			e.level = 0.0
+			e.stage = adsrIdle
 		}
 	}
+	return float32(e.level)
 }
 
 //
 //
 //
 
+// An ADSR is an Effect which shapes the amplitude of its input with an
+// envelope. KeyDown is also passed on upstream, to the nearest Node which
+// accepts it, so a Note sent to the ADSR sounds its source, too; KeyUp
+// isn't, so the source keeps sounding through the release. The ADSR applies
+// the Note's velocity itself, so the source gets the Note at full velocity.
 type ADSR struct {
 	simpleEffect
-
-	mode    ADSRMode
-	percent float32
-
-	attack  time.Duration
-	decay   time.Duration
-	sustain float32
-	release time.Duration
+	envelope
 }
 
 func NewADSR(name string) *ADSR {
 	e := &ADSR{
 		simpleEffect: makeSimpleEffect(name),
-
-		mode:    Attack,
-		percent: 0.0,
-
-		attack:  50 * time.Millisecond,
-		decay:   50 * time.Millisecond,
-		sustain: 0.8,
-		release: 100 * time.Millisecond,
+		envelope:     makeEnvelope(),
 	}
-	go e.simpleEffect.loop(e, e)
 	return e
 }
 
 func NewADSRNode(name string) Node { return Node(NewADSR(name)) }
 
+func (e *ADSR) String() string {
+	return fmt.Sprintf("[%s: %s]", NodeLabel(e), e.envelope.String())
+}
+
 func (e *ADSR) Kind() string { return "ADSR" }
 
-type ADSRMode string
+func (e *ADSR) processEvent(ev Event) {
+	switch ev.Type {
+	case Connect, Disconnect, Connection, Disconnection, Kill:
+		e.simpleEffect.processEvent(ev)
 
-const (
-	Attack  = "attack"
-	Decay   = "decay"
-	Sustain = "sustain"
-	Release = "release"
-)
+	default:
+		e.envelope.processEvent(ev)
+	}
+}
 
-func (e *ADSR) processEvent(ev Event) {
+// forward satisfies the forwarder interface. KeyDown, and the expression of
+// the sounding Note, go upstream as soon as they're delivered, so that a
+// timed Note starts both at once.
+func (e *ADSR) forward(ev Event) {
 	switch ev.Type {
-	case Attack:
-		if d, ok := ev.Arg.(time.Duration); ok {
-			e.attack = d
+	case KeyDown:
+		if n, ok := ev.Arg.(playedNote); ok {
+			n.velocity = 1.0
+			ev.Arg = n
 		}
-	case Decay:
-		if d, ok := ev.Arg.(time.Duration); ok {
-			e.decay = d
+	case Bend, Pressure:
+	default:
+		return
+	}
+	if n := upstreamAccepting(e, ev); n != nilNode {
+		n.Send(ev)
+	}
+}
+
+// upstreamAccepting returns the nearest Node above n which accepts the
+// Event, passing over those which don't, such as a GainLFO between a
+// source and its ADSR. It stops where the signal has more than one source,
+// returning nilNode.
+func upstreamAccepting(n Node, ev Event) Node {
+	for {
+		parents := n.Parents()
+		if len(parents) != 1 {
+			return nilNode
 		}
-	case Sustain:
-		e.sustain = ev.Value
-	case Release:
-		if d, ok := ev.Arg.(time.Duration); ok {
-			e.decay = d
+		n = parents[0]
+		if acceptEvent(n, ev) == nil {
+			return n
 		}
 	}
 }
 
-var (
-	SRINV          = float64(1.0) / float64(SRATE)
-	sampleDuration = time.Duration(int64(SRINV * float64(time.Second)))
-)
-
+// processAudio scales the buffer by the envelope.
 func (e *ADSR) processAudio(buf []float32) {
-	// We are e.percent of the way through the e.mode mode.
-	// Each sample in the buffer represents (1/SRATE) * time.Second time units.
-	// Therefore, every sample advances our percent in the same way:
-	//   percent += <sample duration>/<mode duration>.
-	//
-	// Node that this is a purely signal-triggered ADSR envelope.
-	// That means it must receive a 0.0 before it will retrigger.
-	D("ADSR sampleDuration=%s mode=%s pct=%.2f processing %d", sampleDuration, e.mode, e.percent, len(buf))
-	for i, _ := range buf {
-		switch e.mode {
-		case Attack:
-			// The sample scales from 0 to 100% according to e.percent
-			buf[i] = e.percent * buf[i]
-			e.percent += float32(float64(sampleDuration) / float64(e.attack))
-			if e.percent >= 100.0 {
-				e.percent = 0.0
-				e.mode = Decay
-			}
-
-		case Decay:
-			// The sample scales from 100% to e.sustain according to e.percent
-			span := 1 - e.sustain
-			scale := 1 - (e.percent * span)
-			buf[i] = buf[i] * scale
-			e.percent += float32(float64(sampleDuration) / float64(e.attack))
-			if e.percent >= 100.0 {
-				e.percent = 0.0
-				e.mode = Sustain
-			}
-
-		case Sustain:
-			// > Like an adsr~ triggered by an input float, a zero value
-			// > represents "note-off" and will begin the release stage. unlike
-			// > the event-trigger model, a signal-triggered adsr~ must receive
-			// > a zero before it will retrigger.
-			//
-			// http://www.cycling74.com/docs/max5/refpages/msp-ref/adsr~.html
-			if buf[i] != 0.0 {
-				buf[i] = buf[i] * e.sustain
-				break
-			}
-			e.percent = 0.0
-			e.mode = Release
-			fallthrough
-
-		case Release:
-			if buf[i] != 0.0 { // Retrigger
-				e.mode = Attack
-				e.percent = 0.0
-			}
-
-			// The sample scales from e.sustain to 0% according to e.percent
-			span := e.sustain
-			scale := 1 - (e.percent * span)
-			buf[i] = buf[i] * scale
-			e.percent += float32(float64(sampleDuration) / float64(e.attack))
-
-			if e.percent >= 100.0 { // Complete
-				e.mode = Attack
-				e.percent = 0.0
-			}
-
-		default:
-			panic("impossible")
-		}
+	for i, v := range buf {
+		buf[i] = v * e.envelope.next()
 	}
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// impulseDelay returns how many frames after an impulse the Delay plays
+// it, or -1 if it doesn't within limit frames.
+func impulseDelay(e *Delay, limit int) int {
+	buf := make([]float32, config.BufferSize)
+	for n := 0; n < limit; n += len(buf) {
+		silence(buf)
+		if n == 0 {
+			buf[0] = 1.0
+		}
+		e.processAudio(buf)
+		for i, v := range buf {
+			if v > 0.5 {
+				return n + i
+			}
+		}
+	}
+	return -1
+}
+
+func TestDelay(t *testing.T) {
+	for _, delay := range []float32{0.25, 0.0, 0.01, maxDelay, 1.0 / 3} {
+		e := NewDelay("d")
+		e.processEvent(Event{LoopDelay, delay, nil, 0})
+		want := int(delay * float32(config.SampleRate))
+		if got := impulseDelay(e, want+config.BufferSize); got != want && got != want+1 {
+			t.Errorf("%gs: played %d frames late, want %d", delay, got, want)
+		}
+	}
+	if err := ValidateEvent(Event{LoopDelay, maxDelay + 1, nil, 0}); err == nil {
+		t.Errorf("accepted a delay over %gs", maxDelay)
+	}
+}
+
+func TestSettingDelayDoesntAllocate(t *testing.T) {
+	e := NewDelay("d")
+	delay := float32(0.0)
+	allocs := testing.AllocsPerRun(100, func() {
+		delay = maxDelay - delay
+		e.processEvent(Event{LoopDelay, delay, nil, 0})
+	})
+	if allocs > 0 {
+		t.Errorf("%.0f allocations setting the delay", allocs)
+	}
+}
+
+// stage runs the envelope until it leaves the stage, and returns how many
+// frames that took, and the level it left at.
+func stage(e *envelope, s adsrStage) (int, float32) {
+	n, level := 0, float32(0.0)
+	for ; e.stage == s && n < 10*config.SampleRate; n++ {
+		level = e.next()
+	}
+	return n, level
+}
+
+func TestEnvelope(t *testing.T) {
+	for _, tc := range []struct {
+		script                 []Event
+		note                   string
+		attack, decay, release int // ms
+		peak, sustain          float32
+	}{
+		{nil, "a5", 50, 50, 100, 1.0, 0.8},
+		{[]Event{{Attack, 10, nil, 0}, {Decay, 20, nil, 0}, {Sustain, 0.5, nil, 0}, {Release, 30, nil, 0}},
+			"a5", 10, 20, 30, 1.0, 0.5},
+		{[]Event{CurveEvent("exp"), {Attack, 10, nil, 0}, {Decay, 20, nil, 0}, {Release, 30, nil, 0}},
+			"a5", 10, 20, 30, 1.0, 0.8},
+		{[]Event{{Attack, 0, nil, 0}, {Decay, 0, nil, 0}, {Release, 0, nil, 0}}, "a5", 0, 0, 0, 1.0, 0.8},
+		{[]Event{{Attack, 0, 5 * time.Millisecond, 0}}, "a5@0.5", 5, 50, 100, 0.5, 0.8},
+		{[]Event{{VelScale, 0.5, nil, 0}}, "a5@0.5", 50, 50, 100, 0.75, 0.8},
+		{[]Event{{VelScale, 0, nil, 0}}, "a5@0.5", 50, 50, 100, 1.0, 0.8},
+	} {
+		e := makeEnvelope()
+		for _, ev := range tc.script {
+			e.processEvent(ev)
+		}
+		n, err := ParsePlayedNote(tc.note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.processEvent(Event{KeyDown, 0, n, 0})
+
+		for _, st := range []struct {
+			name  string
+			stage adsrStage
+			ms    int
+			level float32
+		}{
+			{"attack", adsrAttack, tc.attack, tc.peak},
+			{"decay", adsrDecay, tc.decay, tc.peak * tc.sustain},
+			{"release", adsrRelease, tc.release, 0.0},
+		} {
+			if st.stage == adsrRelease {
+				e.processEvent(Event{KeyUp, 0, n, 0})
+			}
+			frames, level := stage(&e, st.stage)
+			want := st.ms * config.SampleRate / 1000
+			if want == 0 {
+				want = 1 // at least a frame
+			}
+			if math.Abs(float64(frames-want)) > 1 || math.Abs(float64(level-st.level)) > 1e-4 {
+				t.Errorf("%v %s: %s took %d frames to %.3f, want %d to %.3f",
+					tc.script, tc.note, st.name, frames, level, want, st.level)
+			}
+		}
+	}
+}
+
+func TestEnvelopeRetriggersFromItsLevel(t *testing.T) {
+	for _, curve := range []string{"linear", "exp"} {
+		e := makeEnvelope()
+		e.processEvent(CurveEvent(curve))
+		e.processEvent(Event{KeyDown, 0, nil, 0})
+		stage(&e, adsrAttack)
+		e.processEvent(Event{KeyUp, 0, nil, 0})
+		var level float32
+		for i := 0; i < config.SampleRate/50; i++ {
+			level = e.next()
+		}
+
+		e.processEvent(Event{KeyDown, 0, nil, 0})
+		if next := e.next(); next < level || next > level+0.01 {
+			t.Errorf("%s: retriggered at %.3f from %.3f", curve, next, level)
+		}
+		want := 50 * config.SampleRate / 1000
+		if frames, _ := stage(&e, adsrAttack); math.Abs(float64(frames+1-want)) > 1 {
+			t.Errorf("%s: retriggered attack took %d frames, want %d", curve, frames+1, want)
+		}
+	}
+}
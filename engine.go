@@ -0,0 +1,813 @@
+package main
+
+import (
+	"code.google.com/p/portaudio-go/portaudio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EngineConfig describes the format of the audio rendered by the Engine.
+type EngineConfig struct {
+	SampleRate int // frames per second
+	BufferSize int // frames per block
+}
+
+// config is the EngineConfig in effect. It's set from flags at startup,
+// before any Nodes are created, and mustn't change afterwards: Nodes
+// compute their coefficients from it.
+var config = EngineConfig{
+	SampleRate: 44100,
+	BufferSize: 2048,
+}
+
+// Validate returns an error if the EngineConfig can't be rendered.
+func (c EngineConfig) Validate() error {
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate %d", c.SampleRate)
+	}
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("invalid buffer size %d", c.BufferSize)
+	}
+	return nil
+}
+
+// SampleDuration returns the duration of a single frame.
+func (c EngineConfig) SampleDuration() time.Duration {
+	return time.Second / time.Duration(c.SampleRate)
+}
+
+// BlockDuration returns the duration of a single block.
+func (c EngineConfig) BlockDuration() time.Duration {
+	return time.Duration(c.BufferSize) * time.Second / time.Duration(c.SampleRate)
+}
+
+// The Engine renders the Field. It's a pull-based system: the audio
+// subsystem asks the Engine for one block of audio at a time, and the Engine
+// produces it by visiting every Node in topological order, so each Node's
+// parents have always rendered the current block before the Node itself.
+//
+// All Events are queued in Node mailboxes, and delivered by the Engine
+// before each block is rendered. That means Nodes never see an Event in the
+// middle of processing a block, and nothing ever needs to block on the
+// audio path. A group of Events sent while holding the Field's lock (eg.
+// the Connect and Connection pair) is always delivered in the same block, so
+// changes to the graph take effect atomically.
+//
+// During rendering, each Node is driven according to the interfaces it
+// satisfies:
+//
+//	valueProvider        generators: fill the output buffer
+//	audioProcessor       simple effects: copy in the parent's buffer,
+//	                     and manipulate it in-place
+//	multiAudioProcessor  multi-input effects and the mixer: combine one
+//	                     buffer from each parent into the output buffer
+//	inputProcessor       audio inputs: fill the output buffer from the
+//	                     audio captured in the current block
+//	clocked              told how many frames have elapsed, after the
+//	                     block is rendered
+//
+// A Node with a timed Event due in the block is rendered in segments: up to
+// the Event's frame, then the Event is applied, then the rest. Nodes which
+// aren't rendered get their timed Events at the start of the block in which
+// they fall.
+type Engine struct {
+	f        *Field
+	sink     AudioSender
+	order    []Node       // topological
+	steps    []renderStep // order, with inputs resolved
+	in       [][]float32  // scratch space for multiAudioProcessors
+	captured []float32    // input of the current block
+	stats    *engineStats
+	taps     map[string][]tap // Node name: taps; guarded by the Field lock
+	rejected chan rejection   // Events which Nodes didn't accept
+	timed    []timedEvent     // awaiting their frames, in order
+	replay   []timedEvent     // replayed, not yet delivered, in order; guarded by the Field lock
+
+	log *eventLog // recording delivered Events; guarded by the Field lock
+
+	sync.Mutex
+	cond *sync.Cond
+	on   bool
+}
+
+// A deliverable Node can receive Events from the Engine.
+type deliverable interface {
+	receive() []mailedEvent
+	eventProcessor
+}
+
+// A renderStep is a Node with its inputs resolved. There's one input per
+// parent, in order; the input of a parent which isn't an AudioSender is nil.
+// They're computed whenever the graph changes, so that rendering needn't.
+type renderStep struct {
+	node    Node
+	inputs  []AudioSender
+	taps    []tap
+	stats   *nodeStats
+	elapsed time.Duration // rendering the current block
+}
+
+// A rejection is an Event which a Node didn't accept, because its type is
+// unknown, or not one of those the Node's kind accepts.
+type rejection struct {
+	node Node
+	ev   Event
+	err  error
+}
+
+// maxRejections is how many rejections may wait to be reported before
+// more are dropped.
+const maxRejections = 64
+
+// A timedEvent is an Event held by the Engine until its frame.
+type timedEvent struct {
+	node Node
+	ev   Event
+	done bool
+}
+
+// maxTimed is how many timed Events the Engine holds before it needs to
+// allocate more room for them.
+const maxTimed = 256
+
+// A forwarder passes some Events on to other Nodes as soon as they're
+// delivered, before they take effect, so that timed Events reach the other
+// Nodes in time to take effect at the same frame.
+type forwarder interface {
+	forward(ev Event)
+}
+
+// A clocked Node keeps time by counting rendered frames.
+type clocked interface {
+	advance(frames int)
+}
+
+// NewEngine returns a new Engine which renders the Field, and plays the
+// output of the sink (typically the Mixer).
+func NewEngine(f *Field, sink AudioSender) *Engine {
+	e := &Engine{
+		f:     f,
+		sink:  sink,
+		order: []Node{},
+		steps: []renderStep{},
+		in:    [][]float32{},
+		stats: newEngineStats(),
+		taps:  map[string][]tap{},
+		cond:  nil,
+
+		captured: make([]float32, config.BufferSize),
+		rejected: make(chan rejection, maxRejections),
+		timed:    make([]timedEvent, 0, maxTimed),
+	}
+	e.cond = sync.NewCond(e)
+	f.Annotate(e.annotate)
+	return e
+}
+
+// Play is a blocking call which initializes the audio subsystem. It should
+// be called on a separate goroutine. Calling Stop will trigger Play to
+// return.
+func (e *Engine) Play() {
+	const (
+		ICHAN = 1
+		OCHAN = 1
+	)
+	e.Lock()
+	defer e.Unlock()
+	e.on = true
+	stream, err := portaudio.OpenDefaultStream(
+		ICHAN,
+		OCHAN,
+		float64(config.SampleRate),
+		config.BufferSize,
+		e,
+	)
+	if err != nil {
+		panic(fmt.Sprintf("open: %s", err))
+	}
+	defer stream.Close()
+	if err = stream.Start(); err != nil {
+		panic(fmt.Sprintf("start: %s", err))
+	}
+	D("Engine playing")
+	e.cond.Wait()
+	if err = stream.Stop(); err != nil {
+		panic(fmt.Sprintf("stop: %s", err))
+	}
+	e.on = false
+	e.cond.Broadcast()
+}
+
+// Stop triggers the Play function to break from its blocking state and tear
+// down the audio subsystem.
+func (e *Engine) Stop() {
+	e.Lock()
+	defer e.Unlock()
+	e.cond.Broadcast()
+}
+
+// Join blocks until the Play function has successfully torn down the audio
+// subsystem.
+func (e *Engine) Join() {
+	e.Lock()
+	defer e.Unlock()
+	for e.on {
+		e.cond.Wait()
+	}
+}
+
+// ProcessAudio is the callback function provided to the PortAudio subsystem
+// which is called on a regular basis to provide audio data. It must return
+// within the duration of one block, so that's the deadline for rendering.
+//
+// The in buffer is the audio captured in the same block, which is yielded
+// by AudioInput Nodes. It may be nil, or short, in which case the rest is
+// silence.
+func (e *Engine) ProcessAudio(in, out []float32) {
+	start := time.Now()
+	n := copy(e.captured, in)
+	silence(e.captured[n:])
+	e.render(start.Add(config.BlockDuration()))
+	e.record(start)
+	buf := e.sink.AudioOut()
+	for i := range out {
+		if i < len(buf) {
+			out[i] = buf[i]
+		} else {
+			out[i] = 0.0
+		}
+	}
+}
+
+// render delivers all pending Events, and then renders one block of audio
+// from every Node in the Field. If the deadline passes while rendering, the
+// remaining Nodes are silenced rather than rendered, and the block counts as
+// an xrun against the Node which was being rendered. The sink is silenced,
+// too, even if it was rendered in time, so that the late block isn't
+// played.
+func (e *Engine) render(deadline time.Time) {
+	now := e.f.Now()
+	steps, missed := e.deliver(now), false
+	t0 := time.Now()
+	for i := range steps {
+		if !missed {
+			e.renderStep(steps[i], now)
+		} else if sender, ok := steps[i].node.(AudioSender); ok {
+			silence(sender.AudioOut())
+		}
+		if sender, ok := steps[i].node.(AudioSender); ok {
+			for _, t := range steps[i].taps {
+				t.observe(sender.AudioOut())
+			}
+		}
+		t1 := time.Now()
+		steps[i].elapsed = t1.Sub(t0)
+		t0 = t1
+
+		if !missed && t1.After(deadline) {
+			missed = true
+			e.xrun(steps[i])
+		}
+	}
+	if missed {
+		silence(e.sink.AudioOut())
+	}
+	for _, n := range e.order {
+		if c, ok := n.(clocked); ok {
+			c.advance(config.BufferSize)
+		}
+	}
+	e.sweep()
+	e.f.elapse(config.BufferSize)
+}
+
+// xrun records a missed deadline against the step.
+func (e *Engine) xrun(step renderStep) {
+	e.stats.Lock()
+	defer e.stats.Unlock()
+	e.stats.xruns++
+	step.stats.xruns++
+}
+
+// record updates the Engine stats after a block has been rendered,
+// beginning at start.
+func (e *Engine) record(start time.Time) {
+	e.stats.Lock()
+	defer e.stats.Unlock()
+	block := config.BlockDuration()
+	if !e.stats.last.IsZero() {
+		interval := start.Sub(e.stats.last)
+		e.stats.interval.add(interval, block)
+		if interval > 2*block {
+			e.stats.late++
+		}
+	}
+	e.stats.last = start
+	e.stats.blocks++
+	e.stats.render.add(time.Since(start), block)
+	e.stats.master.measure(e.sink.AudioOut())
+	for _, step := range e.steps {
+		step.stats.blocks++
+		step.stats.total += step.elapsed
+		if sender, ok := step.node.(AudioSender); ok && e.stats.metering {
+			step.stats.meter.measure(sender.AudioOut())
+		}
+	}
+}
+
+// Tap attaches the tap to the output of the named Node,
+// beginning with the next block.
+func (e *Engine) Tap(name string, t tap) error {
+	e.f.Lock()
+	defer e.f.Unlock()
+	n, err := e.f.get(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := n.(AudioSender); !ok {
+		return fmt.Errorf("not an AudioSender")
+	}
+	e.taps[name] = append(e.taps[name], t)
+	e.f.changed = true
+	return nil
+}
+
+// Untap detaches the tap from the output of the named Node, and closes it.
+func (e *Engine) Untap(name string, t tap) {
+	e.f.Lock()
+	defer e.f.Unlock()
+	taps := e.taps[name]
+	for i := range taps {
+		if taps[i] == t {
+			e.taps[name] = append(taps[:i], taps[i+1:]...)
+			break
+		}
+	}
+	e.f.changed = true
+	t.close()
+}
+
+// closeTaps detaches and closes all taps on the named Node.
+// The caller must hold the Field lock.
+func (e *Engine) closeTaps(name string) {
+	for _, t := range e.taps[name] {
+		t.close()
+	}
+	delete(e.taps, name)
+}
+
+// ReportStats writes the Engine stats to the Output, followed by the Events
+// dropped from each Node's queue.
+func (e *Engine) ReportStats(o Output) {
+	e.stats.report(o)
+
+	nodes := e.queuedNodes()
+	o.Printf("%-16s %12s %6s %8s", "node", "queue", "size", "dropped")
+	for _, n := range nodes {
+		p, size, dropped := n.(queued).queue()
+		o.Printf("%-16s %12s %6d %8d", n.Name(), p, size, dropped)
+	}
+}
+
+// ResetStats clears the Engine stats, and the counts of dropped Events.
+func (e *Engine) ResetStats() {
+	e.stats.reset()
+	for _, n := range e.queuedNodes() {
+		n.(queued).resetDropped()
+	}
+}
+
+// queuedNodes returns the Nodes in the Field with queues, by name.
+func (e *Engine) queuedNodes() []Node {
+	e.f.Lock()
+	defer e.f.Unlock()
+	names := []string{}
+	for name, n := range e.f.nodes {
+		if _, ok := n.(queued); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	nodes := make([]Node, len(names))
+	for i, name := range names {
+		nodes[i] = e.f.nodes[name]
+	}
+	return nodes
+}
+
+// SetMetering turns metering of every AudioSender on or off.
+// The master output is always metered.
+func (e *Engine) SetMetering(on bool) {
+	e.stats.Lock()
+	defer e.stats.Unlock()
+	e.stats.metering = on
+}
+
+// ReportMeters writes the current meter readings to the Output.
+func (e *Engine) ReportMeters(o Output) { e.stats.reportMeters(o) }
+
+// ResetMeters clears peak-hold and clip counters.
+func (e *Engine) ResetMeters() { e.stats.resetMeters() }
+
+// annotate returns the meter reading of the Node, for the Field's
+// Dot representation.
+func (e *Engine) annotate(n Node) string {
+	e.stats.Lock()
+	defer e.stats.Unlock()
+	if sender, ok := n.(AudioSender); ok && sender == e.sink {
+		return e.stats.master.String()
+	}
+	ns, ok := e.stats.nodes[n.Name()]
+	if !ok || !e.stats.metering {
+		return ""
+	}
+	if _, ok := n.(AudioSender); !ok {
+		return ""
+	}
+	return ns.meter.String()
+}
+
+// deliver empties the mailbox of every Node, including recently-deleted
+// ones, and applies each Event to its Node, or holds it until its frame.
+// Events sent as a consequence of delivery are delivered, too. It returns
+// the steps to render the block beginning at the frame now.
+func (e *Engine) deliver(now int64) []renderStep {
+	e.f.Lock()
+	defer e.f.Unlock()
+
+	if e.f.changed {
+		e.sort()
+		e.f.changed = false
+	}
+
+	// Replayed Events are delivered a block at a time, as their frames come
+	// up, rather than all at once, so that they don't overflow the mailboxes.
+	resort := false
+	end := now + int64(config.BufferSize)
+	for len(e.replay) > 0 && e.replay[0].ev.At < end {
+		t := e.replay[0]
+		e.replay[0] = timedEvent{} // don't retain Nodes
+		e.replay = e.replay[1:]
+		if d, ok := t.node.(deliverable); ok && e.f.nodes[t.node.Name()] == t.node {
+			resort = e.apply(t.node, d, mailedEvent{t.ev, true}, now) || resort
+		}
+	}
+	if len(e.replay) == 0 {
+		e.replay = nil
+	}
+
+	for delivered := true; delivered; {
+		delivered = false
+		for _, nodes := range [][]Node{e.order, e.f.reaped} {
+			for _, n := range nodes {
+				d, ok := n.(deliverable)
+				if !ok {
+					continue
+				}
+				for _, m := range d.receive() {
+					delivered = true
+					resort = e.apply(n, d, m, now) || resort
+				}
+			}
+		}
+
+		for i := range e.timed {
+			t := &e.timed[i]
+			if t.ev.At >= end {
+				break
+			}
+			if _, rendered := t.node.(AudioSender); t.done || rendered {
+				continue
+			}
+			t.node.(deliverable).processEvent(t.ev)
+			t.done, delivered = true, true
+		}
+	}
+	e.f.reaped = nil
+
+	if resort {
+		e.sort()
+	}
+	return e.steps
+}
+
+// apply delivers a mailed Event to the Node, from the block starting at
+// now: it's logged and observed, then processed, or held until its frame.
+// It returns true if the rendering order must be recomputed. The caller must
+// hold the Field lock.
+func (e *Engine) apply(n Node, d deliverable, m mailedEvent, now int64) (resort bool) {
+	ev, from := m.Event, fieldSender
+	if m.performed {
+		from = replSender
+	}
+	if err := acceptEvent(n, ev); err != nil {
+		e.reject(n, ev, err)
+		return false
+	}
+	if e.log != nil {
+		frame := now
+		if ev.At > frame {
+			frame = ev.At
+		}
+		e.log.add(from, n, ev, frame)
+	}
+	e.f.bus.observe(nil, n, ev)
+	if fw, ok := n.(forwarder); ok {
+		fw.forward(ev)
+	}
+	switch ev.Type {
+	case Kill:
+		e.closeTaps(n.Name())
+		e.unschedule(n)
+		resort = true
+	case Connect, Disconnect, Connection, Disconnection:
+		resort = true
+	default:
+		if ev.At > now {
+			e.schedule(n, ev)
+			return false
+		}
+	}
+	d.processEvent(ev)
+	return resort
+}
+
+// reject queues the Event, which the Node didn't accept, to be reported.
+// It never blocks.
+func (e *Engine) reject(n Node, ev Event, err error) {
+	select {
+	case e.rejected <- rejection{n, ev, err}:
+	default:
+		D("%s: dropped rejection of %s", n.Name(), ev)
+	}
+}
+
+// ReportRejections writes every Event rejected by a Node to the Output, as
+// they happen. It never returns, so it should be called on a separate
+// goroutine.
+func (e *Engine) ReportRejections(o Output) {
+	for r := range e.rejected {
+		o.Printf("%s -> %s: rejected: %s", r.ev, NodeLabel(r.node), r.err)
+	}
+}
+
+// Perform sends the Event to the Node from the REPL. While Events are being
+// recorded, they're told apart from those which Nodes send each other. If
+// the Node's queue is full, and its policy is to block, Perform waits for
+// the Engine to make room.
+func (e *Engine) Perform(n Node, ev Event) {
+	if q, ok := n.(queued); ok {
+		q.offer(ev, true)
+		return
+	}
+	n.Send(ev)
+}
+
+// RecordEvents starts writing every Event delivered to a Node to the file,
+// as an eventLog.
+func (e *Engine) RecordEvents(path string) error {
+	var clock *Clock
+	if n, err := e.f.Get("clock"); err == nil {
+		clock, _ = n.(*Clock)
+	}
+
+	e.f.Lock()
+	defer e.f.Unlock()
+	if e.log != nil {
+		return fmt.Errorf("already recording to %s", e.log.path)
+	}
+	l, err := newEventLog(path, e.f.Now(), clock)
+	if err != nil {
+		return err
+	}
+	e.log = l
+	return nil
+}
+
+// StopRecordingEvents finishes the file being written by RecordEvents, and
+// describes it.
+func (e *Engine) StopRecordingEvents() (string, error) {
+	e.f.Lock()
+	l := e.log
+	e.log = nil
+	e.f.Unlock()
+
+	if l == nil {
+		return "", fmt.Errorf("not recording")
+	}
+	err := l.close()
+	return l.String(), err
+}
+
+// RecordingEvents describes the file being written by RecordEvents, if any.
+func (e *Engine) RecordingEvents() (string, bool) {
+	e.f.Lock()
+	defer e.f.Unlock()
+	if e.log == nil {
+		return "", false
+	}
+	return e.log.String(), true
+}
+
+// ReplayEvents sends the Events which were sent from the REPL during a
+// recording made by RecordEvents, at the same frames relative to each
+// other, from the next block or, with a Clock, from the same point in a
+// bar. They're delivered as their frames come up. It returns how many were
+// sent. The Field should hold the same Nodes
+// as it did when the recording started.
+func (e *Engine) ReplayEvents(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	events, err := ReadEventLog(e.f, file)
+	if err != nil {
+		return 0, err
+	}
+
+	// One block ahead, so that none of them are late. With a Clock, the
+	// first Event falls as far into its bar as it did when it was recorded,
+	// so that quantized Nodes release on the same Ticks.
+	start := e.f.Now() + int64(config.BufferSize)
+	if n, err := e.f.Get("clock"); err == nil && len(events) > 0 && !math.IsNaN(events[0].beat) {
+		if c, ok := n.(*Clock); ok {
+			first := events[0]
+			beat := c.AlignBeat(first.beat, c.Beat(start+first.ev.At))
+			start = c.Frame(beat) - first.ev.At
+		}
+	}
+	replay := make([]timedEvent, 0, len(events))
+	for _, t := range events {
+		replay = append(replay, timedEvent{node: t.node, ev: t.ev.Timed(start + t.ev.At)})
+	}
+
+	// Any replay still under way goes on, with these merged into it.
+	e.f.Lock()
+	defer e.f.Unlock()
+	replay = append(e.replay[:len(e.replay):len(e.replay)], replay...)
+	sort.SliceStable(replay, func(i, j int) bool { return replay[i].ev.At < replay[j].ev.At })
+	e.replay = replay
+	return len(events), nil
+}
+
+// schedule holds the Event for the Node until its frame. Events are kept in
+// order of their frames, and Events for the same frame in order of arrival.
+func (e *Engine) schedule(n Node, ev Event) {
+	e.timed = append(e.timed, timedEvent{node: n, ev: ev})
+	for i := len(e.timed) - 1; i > 0 && e.timed[i-1].ev.At > ev.At; i-- {
+		e.timed[i], e.timed[i-1] = e.timed[i-1], e.timed[i]
+	}
+}
+
+// unschedule drops every Event held for the Node.
+func (e *Engine) unschedule(n Node) {
+	for i := range e.timed {
+		if e.timed[i].node == n {
+			e.timed[i].done = true
+		}
+	}
+}
+
+// sweep removes the timed Events which have been applied or dropped.
+func (e *Engine) sweep() {
+	held := e.timed[:0]
+	for _, t := range e.timed {
+		if !t.done {
+			held = append(held, t)
+		}
+	}
+	for i := len(held); i < len(e.timed); i++ {
+		e.timed[i] = timedEvent{} // don't retain Nodes
+	}
+	e.timed = held
+}
+
+// sort recomputes the rendering order. The caller must hold the Field lock.
+func (e *Engine) sort() {
+	e.order = topoSort(e.f.nodes)
+	e.steps = make([]renderStep, len(e.order))
+	for i, n := range e.order {
+		e.steps[i].node = n
+		e.steps[i].stats = e.stats.node(n.Name())
+		e.steps[i].taps = append([]tap{}, e.taps[n.Name()]...)
+		for _, parent := range n.Parents() {
+			sender, _ := parent.(AudioSender)
+			e.steps[i].inputs = append(e.steps[i].inputs, sender)
+		}
+	}
+}
+
+// renderStep renders one block of audio, beginning at the frame now, into
+// the output buffer of the Node. Timed Events for the Node which fall in the
+// block are applied in between segments. Nodes which aren't AudioSenders
+// aren't rendered.
+func (e *Engine) renderStep(step renderStep, now int64) {
+	sender, ok := step.node.(AudioSender)
+	if !ok {
+		return
+	}
+	end, from := now+int64(len(sender.AudioOut())), 0
+	for i := range e.timed {
+		t := &e.timed[i]
+		if t.ev.At >= end {
+			break
+		}
+		if t.done || t.node != step.node {
+			continue
+		}
+		if to := int(t.ev.At - now); to > from {
+			e.renderSegment(step, from, to)
+			from = to
+		}
+		t.node.(deliverable).processEvent(t.ev)
+		t.done = true
+	}
+	e.renderSegment(step, from, len(sender.AudioOut()))
+}
+
+// renderSegment renders the frames [from, to) of the block into the output
+// buffer of the Node, which must be an AudioSender.
+func (e *Engine) renderSegment(step renderStep, from, to int) {
+	out := segment(step.node.(AudioSender).AudioOut(), from, to)
+
+	switch x := step.node.(type) {
+	case valueProvider:
+		nextBuffer(x, out)
+
+	case audioProcessor:
+		silence(out)
+		for _, input := range step.inputs {
+			if input != nil {
+				copy(out, segment(input.AudioOut(), from, to))
+			}
+		}
+		x.processAudio(out)
+
+	case multiAudioProcessor:
+		silence(out)
+		e.in = e.in[:0]
+		for _, input := range step.inputs {
+			if input != nil {
+				e.in = append(e.in, segment(input.AudioOut(), from, to))
+			} else {
+				e.in = append(e.in, nil)
+			}
+		}
+		x.processAudio(e.in, out)
+
+	case inputProcessor:
+		x.processInput(segment(e.captured, from, to), out)
+	}
+}
+
+// segment returns the frames [from, to) of the buffer, or as many of them
+// as it has.
+func segment(buf []float32, from, to int) []float32 {
+	if to > len(buf) {
+		to = len(buf)
+	}
+	if from > to {
+		from = to
+	}
+	return buf[from:to]
+}
+
+// topoSort returns the Nodes ordered such that every Node comes after all
+// of its parents. Ties are broken by name, so the order is deterministic.
+func topoSort(nodes map[string]Node) []Node {
+	names := []string{}
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	order, visited := []Node{}, map[string]bool{}
+	var visit func(n Node)
+	visit = func(n Node) {
+		if visited[n.Name()] {
+			return
+		}
+		visited[n.Name()] = true
+		for _, parent := range n.Parents() {
+			if _, ok := nodes[parent.Name()]; ok {
+				visit(parent)
+			}
+		}
+		order = append(order, n)
+	}
+	for _, name := range names {
+		visit(nodes[name])
+	}
+	return order
+}
+
+func silence(buf []float32) {
+	for i := range buf {
+		buf[i] = 0.0
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// slowTap is a tap which takes longer than a block to observe.
+type slowTap struct{}
+
+func (slowTap) observe(buf []float32) { time.Sleep(config.BlockDuration() + 10*time.Millisecond) }
+func (slowTap) close()                {}
+
+func TestMissedDeadlineIsSilent(t *testing.T) {
+	_, e := testPatch(t, "add sine a; a -> mixer; a5 -> a")
+	out := make([]float32, config.BufferSize)
+	loud := func() bool {
+		for _, v := range out {
+			if v != 0.0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	e.ProcessAudio(nil, out)
+	if !loud() {
+		t.Fatal("silent in time")
+	}
+
+	// the sink, rendered last, is what overruns
+	if err := e.Tap("mixer", slowTap{}); err != nil {
+		t.Fatal(err)
+	}
+	e.ProcessAudio(nil, out)
+	if loud() {
+		t.Error("played a late block")
+	}
+	if e.stats.xruns != 1 || e.stats.node("mixer").xruns != 1 {
+		t.Errorf("%d xruns, %d by the mixer", e.stats.xruns, e.stats.node("mixer").xruns)
+	}
+}
@@ -17,6 +17,9 @@ func init() {
 		"sine":           NewSineGeneratorNode,
 		"sine-generator": NewSineGeneratorNode,
 
+		"input": NewAudioInputNode,
+		"adc":   NewAudioInputNode,
+
 		"gainlfo":  NewGainLFONode,
 		"gain-lfo": NewGainLFONode,
 		"lfo":      NewGainLFONode,
@@ -25,8 +28,42 @@ func init() {
 
 		"echo": NewEchoNode,
 
+		"analyzer": NewAnalyzerNode,
+		"analyser": NewAnalyzerNode,
+
+		"tuner": NewTunerNode,
+
+		"envfollow":         NewEnvFollowerNode,
+		"envelope-follower": NewEnvFollowerNode,
+		"follower":          NewEnvFollowerNode,
+
 		"adsr": NewADSRNode,
 
+		"sum":   NewSumNode,
+		"adder": NewSumNode,
+
+		"ringmod":  NewRingModNode,
+		"ring-mod": NewRingModNode,
+		"ring":     NewRingModNode,
+
+		"crossfade": NewCrossfadeNode,
+		"xfade":     NewCrossfadeNode,
+
+		"looper": NewLooperNode,
+		"loop":   NewLooperNode,
+
+		"modlfo":  NewModLFONode,
+		"mod-lfo": NewModLFONode,
+
+		"modenv":  NewModEnvelopeNode,
+		"mod-env": NewModEnvelopeNode,
+
+		"random":     NewModRandomNode,
+		"mod-random": NewModRandomNode,
+
+		"stepseq":  NewModStepNode,
+		"mod-step": NewModStepNode,
+
 		"syn":          NewSynchronizerNode,
 		"sync":         NewSynchronizerNode,
 		"synchro":      NewSynchronizerNode,
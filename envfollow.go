@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	Param = "param"
+	Rate  = "rate"
+)
+
+// ParamEvent sets the type of the Events sent by an EnvFollower.
+// From the REPL, it may be written as eg. param:hz.
+func ParamEvent(param string) Event { return Event{Param + ":" + param, 0.0, nil, 0} }
+
+// An EnvFollower is an Effect which passes its input through unchanged,
+// and tracks its amplitude. rate times per second, it publishes an Event
+// of type param, whose Value is the amplitude mapped onto [min .. max], so
+// that the loudness of one Node can drive a parameter of another.
+//
+// Attack and Release Events set the smoothing of rises and falls in the
+// amplitude, in milliseconds. Events are delivered between blocks, so
+// rates above one per block have no further effect.
+type EnvFollower struct {
+	simpleEffect
+	publication
+
+	param    string
+	min, max float32
+	rate     float32 // Events per second
+
+	attack, release float32 // ms
+	up, down        float32 // coefficients, per frame
+	env             float32
+	frames          int // since the last Event
+}
+
+func NewEnvFollower(name string) *EnvFollower {
+	e := &EnvFollower{
+		simpleEffect: makeSimpleEffect(name),
+
+		param: Gain,
+		min:   0.0,
+		max:   1.0,
+		rate:  20.0,
+	}
+	e.setAttack(10.0)
+	e.setRelease(200.0)
+	return e
+}
+
+func NewEnvFollowerNode(name string) Node { return Node(NewEnvFollower(name)) }
+
+func (e *EnvFollower) String() string {
+	return fmt.Sprintf(
+		"[%s: %s %.2f-%.2f @ %.1f/s, %.0f/%.0f ms]",
+		NodeLabel(e),
+		e.param,
+		e.min,
+		e.max,
+		e.rate,
+		e.attack,
+		e.release,
+	)
+}
+
+func (e *EnvFollower) Kind() string { return "Envelope Follower" }
+
+func (e *EnvFollower) processEvent(ev Event) {
+	if strings.HasPrefix(ev.Type, Param+":") {
+		if param := strings.TrimPrefix(ev.Type, Param+":"); param != "" {
+			e.param = param
+		}
+		return
+	}
+
+	switch ev.Type {
+	case "min":
+		e.min = ev.Value
+	case "max":
+		e.max = ev.Value
+	case Rate:
+		if ev.Value > 0.0 {
+			e.rate = ev.Value
+		}
+	case Attack:
+		if ev.Value >= 0.0 {
+			e.setAttack(ev.Value)
+		}
+	case Release:
+		if ev.Value >= 0.0 {
+			e.setRelease(ev.Value)
+		}
+	default:
+		e.simpleEffect.processEvent(ev)
+	}
+}
+
+func (e *EnvFollower) setAttack(ms float32) {
+	e.attack, e.up = ms, smoothing(ms)
+}
+
+func (e *EnvFollower) setRelease(ms float32) {
+	e.release, e.down = ms, smoothing(ms)
+}
+
+// smoothing returns the per-frame coefficient of a one-pole filter with
+// the time constant ms.
+func smoothing(ms float32) float32 {
+	if ms <= 0.0 {
+		return 0.0
+	}
+	return float32(math.Exp(-1000.0 / (float64(ms) * float64(config.SampleRate))))
+}
+
+// processAudio satisfies the audioProcessor interface. The buffer is left
+// as it is.
+func (e *EnvFollower) processAudio(buf []float32) {
+	for _, v := range buf {
+		if v < 0 {
+			v = -v
+		}
+		c := e.down
+		if v > e.env {
+			c = e.up
+		}
+		e.env = c*e.env + (1-c)*v
+	}
+
+	e.frames += len(buf)
+	period := int(float32(config.SampleRate) / e.rate)
+	if period < 1 {
+		period = 1
+	}
+	if e.frames < period {
+		return
+	}
+	e.frames %= period
+	env := e.env
+	if env > 1.0 {
+		env = 1.0
+	}
+	e.publish(Event{e.param, e.min + (e.max-e.min)*env, nil, 0})
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// The eventBus is the Field's central exchange for Events which aren't
+// addressed to a single Node. Nodes subscribe to Event types, and receive
+// the Events of those types which are Broadcast, or follow a publisher, and
+// receive every Event it Broadcasts; watchers, opened from the REPL,
+// observe the Events Broadcast by a Node or delivered to it. The bus is
+// guarded by the Field's lock.
+type eventBus struct {
+	subs      map[string][]Node // Event type: subscribers, in order
+	followers map[Node][]Node   // publisher: followers, in order
+	watchers  []*watcher
+	nextID    int
+}
+
+func makeEventBus() eventBus {
+	return eventBus{subs: map[string][]Node{}, followers: map[Node][]Node{}, nextID: 1}
+}
+
+// A busSubscriber is subscribed to Broadcasts of some Event types when it's
+// added to the Field.
+type busSubscriber interface {
+	subscriptions() []string
+}
+
+func (b *eventBus) subscribe(n Node, typ string) {
+	for _, other := range b.subs[typ] {
+		if other == n {
+			return
+		}
+	}
+	b.subs[typ] = append(b.subs[typ], n)
+}
+
+// unsubscribe removes the Node's subscription to the type, or all of its
+// subscriptions if the type is "*".
+func (b *eventBus) unsubscribe(n Node, typ string) {
+	for t, nodes := range b.subs {
+		if typ != "*" && t != typ {
+			continue
+		}
+		for i, other := range nodes {
+			if other == n {
+				b.subs[t] = append(nodes[:i], nodes[i+1:]...)
+				break
+			}
+		}
+		if len(b.subs[t]) <= 0 {
+			delete(b.subs, t)
+		}
+	}
+}
+
+// follow makes the Node a follower of the publisher.
+func (b *eventBus) follow(pub, n Node) {
+	for _, other := range b.followers[pub] {
+		if other == n {
+			return
+		}
+	}
+	b.followers[pub] = append(b.followers[pub], n)
+}
+
+// unfollow removes the Node from the followers of the publisher.
+func (b *eventBus) unfollow(pub, n Node) {
+	nodes := b.followers[pub]
+	for i, other := range nodes {
+		if other == n {
+			b.followers[pub] = append(nodes[:i], nodes[i+1:]...)
+			break
+		}
+	}
+	if len(b.followers[pub]) <= 0 {
+		delete(b.followers, pub)
+	}
+}
+
+// remove drops every subscription of the Node, those it follows, and its
+// followers, when it leaves the Field.
+func (b *eventBus) remove(n Node) {
+	b.unsubscribe(n, "*")
+	for pub := range b.followers {
+		b.unfollow(pub, n)
+	}
+	delete(b.followers, n)
+}
+
+// publish sends the Event to its subscribers, and to the followers and
+// watchers of the Node which Broadcast it. A follower which subscribes to
+// the type, too, gets the Event once.
+func (b *eventBus) publish(from Node, ev Event) {
+	subs := b.subs[ev.Type]
+	for _, n := range subs {
+		n.Send(ev)
+	}
+	for _, n := range b.followers[from] {
+		if !contains(subs, n) {
+			n.Send(ev)
+		}
+	}
+	b.observe(from, nil, ev)
+}
+
+func contains(nodes []Node, n Node) bool {
+	for _, other := range nodes {
+		if other == n {
+			return true
+		}
+	}
+	return false
+}
+
+// observe copies the Event, sent by from or delivered to to, to the
+// watchers which match it. It's called on the audio path, so it never
+// blocks or allocates.
+func (b *eventBus) observe(from, to Node, ev Event) {
+	for _, w := range b.watchers {
+		if w.matches(from, to, ev) {
+			w.add(watchedEvent{from, to, ev})
+		}
+	}
+}
+
+//
+//
+//
+
+// A watcher observes the Events on the bus which match its filter: a Node
+// name, and an Event type, either of which may be "*" to match any.
+// Matching Events are queued for the REPL to print; if it falls behind,
+// they're dropped.
+type watcher struct {
+	dropped int64 // atomic
+
+	id     int
+	node   string
+	typ    string
+	events chan watchedEvent
+}
+
+// A watchedEvent is an Event Broadcast by from, or delivered to to.
+type watchedEvent struct {
+	from Node
+	to   Node
+	ev   Event
+}
+
+// maxWatched is how many Events may wait to be printed, per watcher,
+// before more are dropped.
+const maxWatched = 256
+
+func (w *watcher) matches(from, to Node, ev Event) bool {
+	if w.typ != "*" && w.typ != ev.Type {
+		return false
+	}
+	if w.node == "*" {
+		return true
+	}
+	return (from != nil && from.Name() == w.node) || (to != nil && to.Name() == w.node)
+}
+
+func (w *watcher) add(e watchedEvent) {
+	select {
+	case w.events <- e:
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+}
+
+func (w *watcher) String() string {
+	return fmt.Sprintf(
+		"watch %d: %s %s, %d dropped",
+		w.id,
+		w.node,
+		w.typ,
+		atomic.LoadInt64(&w.dropped),
+	)
+}
+
+// report writes every Event the watcher observes to the Output, until the
+// watcher is closed by Unwatch. It should be called on a separate
+// goroutine.
+func (w *watcher) report(o Output) {
+	for e := range w.events {
+		if e.to == nil {
+			o.Printf("watch %d: %s => %s", w.id, e.from.Name(), e.ev)
+		} else {
+			o.Printf("watch %d: %s <- %s", w.id, e.to.Name(), e.ev)
+		}
+	}
+}
+
+//
+//
+//
+
+// Subscribe subscribes the Node to Broadcasts of the Event type.
+func (f *Field) Subscribe(name, typ string) error {
+	spec, _, err := LookupEvent(typ)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	n, err := f.get(name)
+	if err != nil {
+		return err
+	}
+	if !spec.AcceptedBy(n) {
+		return errNotAccepted
+	}
+	f.bus.subscribe(n, typ)
+	return nil
+}
+
+// Unsubscribe cancels the Node's subscription to the Event type, or all of
+// its subscriptions if the type is "*".
+func (f *Field) Unsubscribe(name, typ string) error {
+	f.Lock()
+	defer f.Unlock()
+	n, err := f.get(name)
+	if err != nil {
+		return err
+	}
+	f.bus.unsubscribe(n, typ)
+	return nil
+}
+
+// Follow makes the named Node a follower of the publisher, so that it's
+// sent every Event the publisher Broadcasts.
+func (f *Field) Follow(pub, name string) error {
+	f.Lock()
+	defer f.Unlock()
+	p, n, err := f.getFollower(pub, name)
+	if err != nil {
+		return err
+	}
+	f.bus.follow(p, n)
+	return nil
+}
+
+// Unfollow stops the named Node following the publisher.
+func (f *Field) Unfollow(pub, name string) error {
+	f.Lock()
+	defer f.Unlock()
+	p, n, err := f.getFollower(pub, name)
+	if err != nil {
+		return err
+	}
+	f.bus.unfollow(p, n)
+	return nil
+}
+
+// getFollower returns the publisher, and the Node to follow it. The caller
+// must hold the lock.
+func (f *Field) getFollower(pub, name string) (Node, Node, error) {
+	p, err := f.get(pub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s", pub, err)
+	}
+	if _, ok := p.(publisher); !ok {
+		return nil, nil, fmt.Errorf("%s doesn't publish Events", pub)
+	}
+	n, err := f.get(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s", name, err)
+	}
+	return p, n, nil
+}
+
+// Followers returns the followers of each publisher.
+func (f *Field) Followers() map[string][]string {
+	f.Lock()
+	defer f.Unlock()
+	m := map[string][]string{}
+	for pub, nodes := range f.bus.followers {
+		for _, n := range nodes {
+			m[pub.Name()] = append(m[pub.Name()], n.Name())
+		}
+	}
+	return m
+}
+
+// Subscriptions returns the subscribers to each Event type.
+func (f *Field) Subscriptions() map[string][]string {
+	f.Lock()
+	defer f.Unlock()
+	m := map[string][]string{}
+	for typ, nodes := range f.bus.subs {
+		for _, n := range nodes {
+			m[typ] = append(m[typ], n.Name())
+		}
+	}
+	return m
+}
+
+// Broadcast sends the Event, on behalf of the Node, to every Node which
+// subscribed to its type.
+func (f *Field) Broadcast(from Node, ev Event) {
+	f.Lock()
+	defer f.Unlock()
+	f.bus.publish(from, ev)
+}
+
+// Watch opens a watcher of the Events Broadcast by, or delivered to, the
+// named Node, of the type. Either may be "*".
+func (f *Field) Watch(name, typ string) (*watcher, error) {
+	if typ != "*" {
+		if _, _, err := LookupEvent(typ); err != nil {
+			return nil, err
+		}
+	}
+	f.Lock()
+	defer f.Unlock()
+	if name != "*" {
+		if _, err := f.get(name); err != nil {
+			return nil, err
+		}
+	}
+	w := &watcher{
+		id:     f.bus.nextID,
+		node:   name,
+		typ:    typ,
+		events: make(chan watchedEvent, maxWatched),
+	}
+	f.bus.nextID++
+	f.bus.watchers = append(f.bus.watchers, w)
+	return w, nil
+}
+
+// Unwatch closes the watcher with the ID, or every watcher if the ID is 0.
+func (f *Field) Unwatch(id int) error {
+	f.Lock()
+	defer f.Unlock()
+	found := false
+	watchers := f.bus.watchers[:0]
+	for _, w := range f.bus.watchers {
+		if id == 0 || w.id == id {
+			close(w.events)
+			found = true
+			continue
+		}
+		watchers = append(watchers, w)
+	}
+	f.bus.watchers = watchers
+	if !found && id != 0 {
+		return fmt.Errorf("no watch %d", id)
+	}
+	return nil
+}
+
+// Watchers describes every open watcher.
+func (f *Field) Watchers() []string {
+	f.Lock()
+	defer f.Unlock()
+	s := []string{}
+	for _, w := range f.bus.watchers {
+		s = append(s, w.String())
+	}
+	return s
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// An eventLog writes every Event delivered by the Engine to a file, one per
+// line, as
+//
+//	<frame> <beat> <sender> <target> <type> <value> <arg>
+//
+// separated by tabs. The frame is counted from the start of the recording,
+// and is the one at which the Event took effect; the beat is the Clock's.
+// The sender is "repl" for Events sent from the REPL, and "field" for those
+// the Nodes sent each other. Entries are passed to a background writer
+// goroutine; if it falls behind, they're dropped rather than blocking the
+// audio path.
+type eventLog struct {
+	logged  int64 // atomic
+	dropped int64 // atomic
+
+	path    string
+	start   int64  // frame
+	clock   *Clock // may be nil
+	entries chan loggedEvent
+	done    chan error
+}
+
+// A loggedEvent is an Event as it was delivered.
+type loggedEvent struct {
+	frame int64
+	from  string
+	node  Node
+	ev    Event
+}
+
+const (
+	replSender  = "repl"
+	fieldSender = "field"
+)
+
+// maxLogged is how many Events may wait for the writer before more are
+// dropped.
+const maxLogged = 4096
+
+func newEventLog(path string, start int64, clock *Clock) (*eventLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &eventLog{
+		path:    path,
+		start:   start,
+		clock:   clock,
+		entries: make(chan loggedEvent, maxLogged),
+		done:    make(chan error, 1),
+	}
+	go l.write(file)
+	return l, nil
+}
+
+// add queues the Event, which took effect at the frame, to be written. It's
+// called on the audio path, so it never blocks or allocates.
+func (l *eventLog) add(from string, n Node, ev Event, frame int64) {
+	select {
+	case l.entries <- loggedEvent{frame, from, n, ev}:
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+	}
+}
+
+// close finishes the file, and returns how that went.
+func (l *eventLog) close() error {
+	close(l.entries)
+	return <-l.done
+}
+
+func (l *eventLog) String() string {
+	return fmt.Sprintf(
+		"%s: %d Events, %d dropped",
+		l.path,
+		atomic.LoadInt64(&l.logged),
+		atomic.LoadInt64(&l.dropped),
+	)
+}
+
+func (l *eventLog) write(file *os.File) {
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "# goop events: %d Hz, from frame %d\n", config.SampleRate, l.start)
+	fmt.Fprintf(w, "# frame\tbeat\tsender\ttarget\ttype\tvalue\targ\n")
+	for entry := range l.entries {
+		beat := "-"
+		if l.clock != nil {
+			beat = strconv.FormatFloat(l.clock.Beat(entry.frame), 'f', 4, 64)
+		}
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.frame-l.start,
+			beat,
+			entry.from,
+			entry.node.Name(),
+			entry.ev.Type,
+			strconv.FormatFloat(float64(entry.ev.Value), 'g', -1, 32),
+			formatArg(entry.ev.Arg),
+		)
+		atomic.AddInt64(&l.logged, 1)
+	}
+	err := w.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	l.done <- err
+}
+
+// formatArg writes an Event's Arg so that parseArg can read it back.
+// Played Notes are written in full, rather than rounded as by String.
+func formatArg(arg interface{}) string {
+	switch x := arg.(type) {
+	case nil:
+		return "-"
+	case Node:
+		return x.Name()
+	case *modRoute:
+		return x.target.Name() + "." + x.param
+	case time.Duration:
+		return x.String()
+	case playedNote:
+		return fmt.Sprintf("%s@%g,bend=%g,pressure=%g", x.Note, x.velocity, x.bend, x.pressure)
+	case *detectedNote:
+		return x.Note.String() // the cents follow from the Value
+	case Note:
+		return x.String()
+	}
+	return fmt.Sprintf("%v", arg)
+}
+
+// parseArg reads an Arg written by formatArg, for an Event with the Value.
+func parseArg(f *Field, k argKind, s string, value float32) (interface{}, error) {
+	if s == "-" {
+		return nil, nil
+	}
+	switch k {
+	case nodeArg:
+		return f.Get(s)
+	case noteArg:
+		if s == NoteZero().String() {
+			return NoteZero(), nil
+		}
+		return ParsePlayedNote(s)
+	case routeArg:
+		toks := strings.SplitN(s, ".", 2)
+		if len(toks) != 2 {
+			return nil, fmt.Errorf("%s: not a route", s)
+		}
+		target, err := f.Get(toks[0])
+		if err != nil {
+			return nil, err
+		}
+		return RouteEvent(target, toks[1], value).Arg, nil
+	case durationArg:
+		return time.ParseDuration(s)
+	}
+	return nil, fmt.Errorf("%s Args can't be replayed", k)
+}
+
+//
+//
+//
+
+// A replayedEvent is an Event read from an eventLog, for the Node, with the
+// Clock's beat when it took effect, or NaN if there was no Clock.
+type replayedEvent struct {
+	node Node
+	ev   Event
+	beat float64
+}
+
+// ReadEventLog reads the Events sent from the REPL out of an eventLog, with
+// their targets in the Field. Each Event's At is its frame in the log, from
+// the start of the recording. Events the Nodes sent each other aren't
+// returned: they'll be sent again as the replayed Events take effect.
+func ReadEventLog(f *Field, r io.Reader) ([]replayedEvent, error) {
+	var events []replayedEvent
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		if strings.HasPrefix(s.Text(), "#") || strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		toks := strings.Split(s.Text(), "\t")
+		if len(toks) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 fields, got %d", line, len(toks))
+		}
+		if toks[2] != replSender {
+			continue
+		}
+		n, ev, err := parseLoggedEvent(f, toks)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		beat := math.NaN()
+		if toks[1] != "-" {
+			if beat, err = strconv.ParseFloat(toks[1], 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid beat %s", line, toks[1])
+			}
+		}
+		events = append(events, replayedEvent{n, ev, beat})
+	}
+	return events, s.Err()
+}
+
+func parseLoggedEvent(f *Field, toks []string) (Node, Event, error) {
+	frame, err := strconv.ParseInt(toks[0], 10, 64)
+	if err != nil || frame < 0 {
+		return nil, Event{}, fmt.Errorf("invalid frame %s", toks[0])
+	}
+	n, err := f.Get(toks[3])
+	if err != nil {
+		return nil, Event{}, fmt.Errorf("%s: %s", toks[3], err)
+	}
+	spec, _, err := LookupEvent(toks[4])
+	if err != nil {
+		return nil, Event{}, fmt.Errorf("%s: %s", toks[4], err)
+	}
+	value, err := strconv.ParseFloat(toks[5], 32)
+	if err != nil {
+		return nil, Event{}, fmt.Errorf("invalid value %s", toks[5])
+	}
+	arg, err := parseArg(f, spec.Arg, toks[6], float32(value))
+	if err != nil {
+		return nil, Event{}, fmt.Errorf("%s: %s", toks[4], err)
+	}
+	ev := Event{toks[4], float32(value), arg, frame}
+	if err := ValidateEvent(ev); err != nil {
+		return nil, Event{}, fmt.Errorf("%s: %s", ev, err)
+	}
+	if err := acceptEvent(n, ev); err != nil {
+		return nil, Event{}, fmt.Errorf("%s -> %s: %s", ev, n.Name(), err)
+	}
+	return n, ev, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// readEventLog reads the Events sent from the REPL out of the eventLog.
+func readEventLog(t *testing.T, f *Field, path string) []replayedEvent {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	events, err := ReadEventLog(f, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestEventLogRoundTrip(t *testing.T) {
+	const blocks, perBlock = 15, 100 // more than a mailbox holds
+	dir := t.TempDir()
+	recorded, replayed := filepath.Join(dir, "recorded"), filepath.Join(dir, "replayed")
+
+	f, e := testPatch(t, "add sine a; a -> mixer")
+	a, _ := f.Get("a")
+	if err := e.RecordEvents(recorded); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < blocks; i++ {
+		next := f.Now() + int64(config.BufferSize)
+		for j := 0; j < perBlock; j++ {
+			e.Perform(a, Event{Gain, float32(i*perBlock + j), nil, next + int64(j%config.BufferSize)})
+		}
+		e.ProcessAudio(nil, nil)
+	}
+	e.ProcessAudio(nil, nil)
+	if _, err := e.StopRecordingEvents(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, e = testPatch(t, "add sine a; a -> mixer")
+	if err := e.RecordEvents(replayed); err != nil {
+		t.Fatal(err)
+	}
+	n, err := e.ReplayEvents(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != blocks*perBlock {
+		t.Fatalf("replayed %d Events, want %d", n, blocks*perBlock)
+	}
+	for i := 0; i < 10*blocks; i++ {
+		e.ProcessAudio(nil, nil)
+	}
+	if _, err := e.StopRecordingEvents(); err != nil {
+		t.Fatal(err)
+	}
+
+	want, got := readEventLog(t, f, recorded), readEventLog(t, f, replayed)
+	if len(got) != len(want) {
+		t.Fatalf("replay delivered %d Events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		w, g := want[i].ev, got[i].ev
+		if g.Type != w.Type || g.Value != w.Value || g.At-got[0].ev.At != w.At-want[0].ev.At {
+			t.Fatalf("Event %d: replayed %s at %d, want %s at %d",
+				i, g, g.At-got[0].ev.At, w, w.At-want[0].ev.At)
+		}
+	}
+}
+
+func TestLoggedEventsParse(t *testing.T) {
+	f, _ := testPatch(t, "add sine a; add adsr env; add delay d; add modlfo m; add sum s")
+	a, _ := f.Get("a")
+	d, _ := f.Get("d")
+	m, _ := f.Get("m")
+	env, _ := f.Get("env")
+	sum, _ := f.Get("s")
+	played, _ := ParsePlayedNote("c5@0.5,bend=-2,pressure=0.25")
+	for _, tc := range []struct {
+		node Node
+		ev   Event
+	}{
+		{a, Event{Gain, 0.125, nil, 0}},
+		{sum, Event{"gain:a", 1, nil, 0}},
+		{a, PitchEvent(445)},
+		{env, Event{KeyDown, 1, played, 0}},
+		{env, Event{Attack, 0, 1500 * time.Microsecond, 0}},
+		{m, RouteEvent(d, "delay", 0.5)},
+		{m, Event{Unsubscribe, 0, d, 0}},
+		{env, CurveEvent("exp")},
+	} {
+		toks := []string{"1234", "-", replSender, tc.node.Name(), tc.ev.Type,
+			strconv.FormatFloat(float64(tc.ev.Value), 'g', -1, 32), formatArg(tc.ev.Arg)}
+		n, ev, err := parseLoggedEvent(f, toks)
+		if err != nil {
+			t.Errorf("%v: %s", toks, err)
+			continue
+		}
+		if n != tc.node || ev.Type != tc.ev.Type || ev.Value != tc.ev.Value ||
+			formatArg(ev.Arg) != formatArg(tc.ev.Arg) || ev.At != 1234 {
+			t.Errorf("%v: read %s -> %s, want %s -> %s",
+				toks, ev, n.Name(), tc.ev, tc.node.Name())
+		}
+	}
+
+	for _, toks := range [][]string{
+		{"-1", "-", replSender, "a", Gain, "1", "-"},
+		{"0", "-", replSender, "nobody", Gain, "1", "-"},
+		{"0", "-", replSender, "a", "nonsense", "1", "-"},
+		{"0", "-", replSender, "a", Gain, "-1", "-"},
+		{"0", "-", replSender, "a", Attack, "1", "-"}, // not accepted
+		{"0", "-", replSender, "env", Attack, "1", "soon"},
+	} {
+		if _, _, err := parseLoggedEvent(f, toks); err == nil {
+			t.Errorf("%v: no error", toks)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // The eventProcessor interface is designed to be implemented by concrete
@@ -15,32 +18,306 @@ type eventProcessor interface {
 }
 
 // An EventReceiver is capable of receiving and processing Events.
+// Send must never block.
 type EventReceiver interface {
-	Events() chan<- Event
+	Send(ev Event)
+}
+
+// A queuePolicy decides what a mailbox does with an Event sent when it's
+// full. Graph Events (Connect, Disconnect, Connection, Disconnection and
+// Kill) are always queued, whatever the policy, so the graph stays whole.
+type queuePolicy int
+
+const (
+	dropOldest     queuePolicy = iota // make room by dropping the oldest Event
+	dropNewest                        // drop the Event being sent
+	coalesceEvents                    // replace a queued Event of the same type, Arg and time (see sameArg), or drop the oldest
+	blockSender                       // from the REPL, wait up to a block for the Engine to make room; then, or from the Engine, drop the Event
+)
+
+func (p queuePolicy) String() string {
+	switch p {
+	case dropNewest:
+		return "drop-newest"
+	case coalesceEvents:
+		return "coalesce"
+	case blockSender:
+		return "block"
+	}
+	return "drop-oldest"
+}
+
+// parseQueuePolicy returns the queuePolicy named s.
+func parseQueuePolicy(s string) (queuePolicy, error) {
+	switch s {
+	case "drop-oldest", "oldest":
+		return dropOldest, nil
+	case "drop-newest", "newest":
+		return dropNewest, nil
+	case "coalesce":
+		return coalesceEvents, nil
+	case "block":
+		return blockSender, nil
+	}
+	return dropOldest, fmt.Errorf("invalid queue policy %s", s)
+}
+
+// maxQueued is how many Events a mailbox holds by default.
+const maxQueued = 1024
+
+// A mailbox may be embedded into any type to satisfy the EventReceiver
+// interface. Sent Events are queued in the mailbox until the Engine
+// delivers them to the containing Node, in between audio blocks.
+//
+// A mailbox alternates between two queues, so that once they've grown to
+// accommodate the usual flow of Events, it doesn't allocate. Each queue is
+// bounded; when it's full, the mailbox's queuePolicy decides which Event
+// is lost, and the loss is counted. Events performed from the REPL are
+// marked as such, so the Engine can tell them apart when it records them.
+type mailbox struct {
+	mtx     sync.Mutex
+	events  []mailedEvent
+	spare   []mailedEvent
+	limit   int // 0 is maxQueued
+	policy  queuePolicy
+	dropped int
+	room    chan struct{} // closed when the Engine empties the mailbox; for blockSender
+}
+
+// A mailedEvent is an Event in a mailbox, and whether it was performed
+// from the REPL.
+type mailedEvent struct {
+	Event
+	performed bool
+}
+
+// Send satisfies the EventReceiver interface. It never blocks: the Engine
+// may be the sender, and it's the only one which can make room.
+func (mb *mailbox) Send(ev Event) { mb.offer(ev, false) }
+
+// offer queues the Event, and returns false if it's dropped instead. An
+// Event performed from the REPL is marked as such; if the queue is full
+// under the blockSender policy, it waits up to a block for the Engine to
+// make room. The Engine empties the mailbox under the Field lock, so the
+// caller mustn't hold it.
+func (mb *mailbox) offer(ev Event, performed bool) bool {
+	mb.mtx.Lock()
+	defer mb.mtx.Unlock()
+	m := mailedEvent{ev, performed}
+	if isGraphEvent(ev) {
+		mb.events = append(mb.events, m)
+		return true
+	}
+	if mb.policy == coalesceEvents && mb.coalesce(m) {
+		return true
+	}
+	if len(mb.events) >= mb.capacity() {
+		switch mb.policy {
+		case dropNewest:
+			mb.dropped++
+			return false
+		case blockSender:
+			if !performed || !mb.wait() {
+				mb.dropped++
+				return false
+			}
+		default:
+			mb.dropOldest()
+		}
+	}
+	mb.events = append(mb.events, m)
+	return true
+}
+
+// receive empties the mailbox, returning every Event sent since the last
+// call, in order. The returned slice is only valid until the next call.
+func (mb *mailbox) receive() []mailedEvent {
+	mb.mtx.Lock()
+	defer mb.mtx.Unlock()
+	events := mb.events
+	mb.events, mb.spare = mb.spare[:0], events
+	if mb.room != nil {
+		close(mb.room)
+		mb.room = nil
+	}
+	return events
+}
+
+// setQueue sets the policy and size of the mailbox's queue. A size of 0 is
+// the default.
+func (mb *mailbox) setQueue(p queuePolicy, limit int) {
+	mb.mtx.Lock()
+	defer mb.mtx.Unlock()
+	mb.policy, mb.limit = p, limit
+}
+
+// queue returns the policy and size of the mailbox's queue, and how many
+// Events it has dropped.
+func (mb *mailbox) queue() (queuePolicy, int, int) {
+	mb.mtx.Lock()
+	defer mb.mtx.Unlock()
+	return mb.policy, mb.capacity(), mb.dropped
+}
+
+// resetDropped clears the count of dropped Events.
+func (mb *mailbox) resetDropped() {
+	mb.mtx.Lock()
+	defer mb.mtx.Unlock()
+	mb.dropped = 0
+}
+
+func (mb *mailbox) capacity() int {
+	if mb.limit <= 0 {
+		return maxQueued
+	}
+	return mb.limit
+}
+
+// coalesce replaces the latest queued Event with the same type, Arg and
+// time as ev, if there is one.
+func (mb *mailbox) coalesce(ev mailedEvent) bool {
+	for i := len(mb.events) - 1; i >= 0; i-- {
+		q := mb.events[i]
+		if q.Type == ev.Type && q.At == ev.At && sameArg(q.Arg, ev.Arg) {
+			mb.events[i] = ev
+			mb.dropped++
+			return true
+		}
+	}
+	return false
+}
+
+// sameArg returns true if two Args are the same: both nil, the same
+// pointer, or equal values of a type which can be compared without
+// panicking. Args of any other type, such as slices, or structs holding
+// interfaces, are never the same, so they're never coalesced.
+func sameArg(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) || !safelyComparable(t) {
+		return false
+	}
+	return a == b
+}
+
+// safelyComparable returns true if values of the type can be compared with
+// == without panicking.
+func safelyComparable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Func, reflect.Interface:
+		return false
+	case reflect.Array:
+		return safelyComparable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !safelyComparable(t.Field(i).Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// dropOldest drops the oldest queued Event which isn't a graph Event.
+func (mb *mailbox) dropOldest() {
+	for i, q := range mb.events {
+		if !isGraphEvent(q.Event) {
+			mb.events = append(mb.events[:i], mb.events[i+1:]...)
+			mb.dropped++
+			return
+		}
+	}
+}
+
+// wait releases the lock until the Engine empties the mailbox, or a block
+// has passed, and returns true if there's room.
+func (mb *mailbox) wait() bool {
+	timeout := time.After(config.BlockDuration())
+	for len(mb.events) >= mb.capacity() {
+		if mb.room == nil {
+			mb.room = make(chan struct{})
+		}
+		room := mb.room
+		mb.mtx.Unlock()
+		select {
+		case <-room:
+			mb.mtx.Lock()
+		case <-timeout:
+			mb.mtx.Lock()
+			return len(mb.events) < mb.capacity()
+		}
+	}
+	return true
+}
+
+// A queued Node's Events wait in a bounded queue, such as a mailbox's.
+type queued interface {
+	offer(ev Event, performed bool) bool
+	setQueue(p queuePolicy, limit int)
+	queue() (queuePolicy, int, int)
+	resetDropped()
 }
 
 // Event describes any asynchronous thing which may be
 // sent to Nodes in the Field.
+//
+// An Event with a time, At, takes effect at exactly that frame of the
+// Field's timeline: the Engine holds it until the block containing the
+// frame, and renders the Node up to the frame before applying it. An Event
+// without a time, or with a time which has passed, takes effect at the
+// start of the next block.
 type Event struct {
 	Type  string
 	Value float32
 	Arg   interface{}
+	At    int64 // frame; 0 is as soon as possible
+}
+
+func (ev Event) String() string {
+	s := fmt.Sprintf("%s %.1f", ev.Type, ev.Value)
+	if n, ok := ev.Arg.(velocityNote); ok {
+		s += fmt.Sprintf(" %s", n)
+	}
+	if c, ok := ev.Arg.(*Clock); ok && ev.Type == Tick {
+		s += fmt.Sprintf(" %s", c.TickPosition(ev))
+	}
+	if ev.At > 0 {
+		s += fmt.Sprintf(" @%d", ev.At)
+	}
+	return "[" + s + "]"
+}
+
+// Timed returns a copy of the Event which takes effect at the frame.
+func (ev Event) Timed(at int64) Event {
+	ev.At = at
+	return ev
 }
 
-func ConnectEvent(dst Node) Event       { return Event{Connect, 0.0, dst} }
-func DisconnectEvent(dst Node) Event    { return Event{Disconnect, 0.0, dst} }
-func ConnectionEvent(src Node) Event    { return Event{Connection, 0.0, src} }
-func DisconnectionEvent(src Node) Event { return Event{Disconnection, 0.0, src} }
-func KillEvent() Event                  { return Event{Kill, 0.0, nil} }
+func ConnectEvent(dst Node) Event       { return Event{Connect, 0.0, dst, 0} }
+func DisconnectEvent(dst Node) Event    { return Event{Disconnect, 0.0, dst, 0} }
+func ConnectionEvent(src Node) Event    { return Event{Connection, 0.0, src, 0} }
+func DisconnectionEvent(src Node) Event { return Event{Disconnection, 0.0, src, 0} }
+func KillEvent() Event                  { return Event{Kill, 0.0, nil, 0} }
 
 const (
 	Connect       = "connect"
 	Disconnect    = "disconnect"
 	Connection    = "connection"
 	Disconnection = "disconnection"
-	Kill          = "kill" // stop all processing loops
+	Kill          = "kill" // sent to a Node when it leaves the Field
 )
 
+// isGraphEvent returns true if the Event changes the graph.
+func isGraphEvent(ev Event) bool {
+	switch ev.Type {
+	case Connect, Disconnect, Connection, Disconnection, Kill:
+		return true
+	}
+	return false
+}
+
 // ParseArbitraryEvents attempts to parse the passed string into an
 // arbitrary Event. An arbitrary event has the grammar
 // ArbitraryEvent := <string> [ "-" <float32> ]
@@ -48,14 +325,14 @@ func ParseArbitraryEvent(s string) (Event, error) {
 	toks := strings.Split(s, "-")
 	switch len(toks) {
 	case 1:
-		return Event{toks[0], 0.0, nil}, nil
+		return Event{toks[0], 0.0, nil, 0}, nil
 
 	case 2:
 		val, err := strconv.ParseFloat(toks[1], 32)
 		if err != nil {
 			return Event{}, fmt.Errorf("bad Value %s", toks[1])
 		}
-		return Event{toks[0], float32(val), nil}, nil
+		return Event{toks[0], float32(val), nil, 0}, nil
 
 	default:
 		return Event{}, fmt.Errorf("couldn't parse Event")
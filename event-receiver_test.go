@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fill returns a mailbox with the policy, holding Events of the type with
+// Values 0 .. limit-1, at frames 1 .. limit.
+func fill(p queuePolicy, limit int, typ string) *mailbox {
+	mb := &mailbox{}
+	mb.setQueue(p, limit)
+	for i := 0; i < limit; i++ {
+		mb.offer(Event{typ, float32(i), nil, int64(i + 1)}, false)
+	}
+	return mb
+}
+
+// values returns the Values of the Events queued in the mailbox.
+func values(mb *mailbox) []float32 {
+	var vs []float32
+	for _, m := range mb.receive() {
+		vs = append(vs, m.Value)
+	}
+	return vs
+}
+
+func TestQueuePolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy  queuePolicy
+		sent    Event
+		queued  bool
+		want    []float32
+		dropped int
+	}{
+		{dropOldest, Event{Gain, 9, nil, 0}, true, []float32{1, 2, 9}, 1},
+		{dropNewest, Event{Gain, 9, nil, 0}, false, []float32{0, 1, 2}, 1},
+		{coalesceEvents, Event{Gain, 9, nil, 3}, true, []float32{0, 1, 9}, 1},
+		{coalesceEvents, Event{Pitch, 9, nil, 3}, true, []float32{1, 2, 9}, 1},
+		{coalesceEvents, Event{Gain, 9, nil, 100}, true, []float32{1, 2, 9}, 1},
+		{blockSender, Event{Gain, 9, nil, 0}, false, []float32{0, 1, 2}, 1},
+		{dropNewest, KillEvent(), true, []float32{0, 1, 2, 0}, 0},
+	} {
+		mb := fill(tc.policy, 3, Gain)
+		if queued := mb.offer(tc.sent, false); queued != tc.queued {
+			t.Errorf("%s: %s queued %v, want %v", tc.policy, tc.sent, queued, tc.queued)
+		}
+		_, _, dropped := mb.queue()
+		if got := values(mb); !equalValues(got, tc.want) || dropped != tc.dropped {
+			t.Errorf("%s: %s left %v, %d dropped, want %v, %d dropped",
+				tc.policy, tc.sent, got, dropped, tc.want, tc.dropped)
+		}
+	}
+}
+
+func equalValues(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBlockSenderWaitsForRoom(t *testing.T) {
+	mb := fill(blockSender, 3, Gain)
+	go func() {
+		time.Sleep(config.BlockDuration() / 4)
+		mb.receive()
+	}()
+	if !mb.offer(Event{Gain, 9, nil, 0}, true) {
+		t.Fatal("performed Event dropped while the Engine made room")
+	}
+
+	mb = fill(blockSender, 3, Gain)
+	start := time.Now()
+	if mb.offer(Event{Gain, 9, nil, 0}, true) {
+		t.Fatal("performed Event queued, with no room")
+	}
+	if time.Since(start) < config.BlockDuration() {
+		t.Error("gave up before a block had passed")
+	}
+	if _, _, dropped := mb.queue(); dropped != 1 {
+		t.Errorf("%d dropped, want 1", dropped)
+	}
+	mb.resetDropped()
+	if _, _, dropped := mb.queue(); dropped != 0 {
+		t.Errorf("%d dropped after reset", dropped)
+	}
+}
+
+func TestCoalesceArgs(t *testing.T) {
+	c := &Clock{}
+	for _, tc := range []struct {
+		a, b interface{}
+		same bool
+	}{
+		{nil, nil, true},
+		{nil, c, false},
+		{c, c, true},
+		{c, &Clock{}, false},
+		{time.Second, time.Second, true},
+		{time.Second, time.Minute, false},
+		{[]float32{1}, []float32{1}, false}, // not comparable
+		{map[string]int{}, map[string]int{}, false},
+		{struct{ x interface{} }{[]int{}}, struct{ x interface{} }{[]int{}}, false},
+	} {
+		mb := &mailbox{}
+		mb.setQueue(coalesceEvents, 2)
+		mb.offer(Event{Route, 0, tc.a, 0}, false)
+		mb.offer(Event{Route, 1, tc.b, 0}, false)
+		want := []float32{0, 1}
+		if tc.same {
+			want = []float32{1}
+		}
+		if got := values(mb); !equalValues(got, want) {
+			t.Errorf("%v, %v: left %v, want %v", tc.a, tc.b, got, want)
+		}
+	}
+}
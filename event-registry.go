@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A valueKind describes the Values accepted by an Event type.
+type valueKind int
+
+const (
+	noValue     valueKind = iota // ignored
+	anyValue                     // any number
+	nonNegative                  // >= 0
+	positive                     // > 0
+	unitValue                    // [0 .. 1]
+	msValue                      // a duration in milliseconds, >= 0
+	countValue                   // a whole number, >= 1
+	rateValue                    // per second, > 0 and at most the sample rate
+	delayValue                   // seconds, in [0 .. maxDelay]
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case anyValue:
+		return "number"
+	case nonNegative:
+		return "number >= 0"
+	case positive:
+		return "number > 0"
+	case unitValue:
+		return "number in [0 .. 1]"
+	case msValue:
+		return "milliseconds"
+	case countValue:
+		return "count"
+	case rateValue:
+		return fmt.Sprintf("rate in (0 .. %d]", config.SampleRate)
+	case delayValue:
+		return fmt.Sprintf("number of seconds in [0 .. %g]", maxDelay)
+	}
+	return "none"
+}
+
+func (k valueKind) check(v float32) error {
+	ok := true
+	switch k {
+	case nonNegative, msValue:
+		ok = v >= 0.0
+	case positive:
+		ok = v > 0.0
+	case unitValue:
+		ok = v >= 0.0 && v <= 1.0
+	case countValue:
+		ok = v >= 1.0 && v == float32(int(v))
+	case rateValue:
+		ok = v > 0.0 && v <= float32(config.SampleRate)
+	case delayValue:
+		ok = v >= 0.0 && v <= maxDelay
+	}
+	if !ok {
+		return fmt.Errorf("value %g isn't a %s", v, k)
+	}
+	return nil
+}
+
+// An argKind describes the Arg carried by an Event type. Args are set by
+// the code which builds the Event; they can't be written in the REPL.
+type argKind int
+
+const (
+	noArg       argKind = iota
+	nodeArg             // a Node
+	noteArg             // optionally, a Note played at the Value
+	clockArg            // the *Clock
+	routeArg            // a *modRoute
+	durationArg         // optionally, a time.Duration overriding the Value
+)
+
+func (k argKind) String() string {
+	switch k {
+	case nodeArg:
+		return "Node"
+	case noteArg:
+		return "Note"
+	case clockArg:
+		return "Clock"
+	case routeArg:
+		return "route"
+	case durationArg:
+		return "duration"
+	}
+	return "none"
+}
+
+func (k argKind) check(arg interface{}) error {
+	ok := true
+	switch k {
+	case noArg, durationArg:
+		_, isDuration := arg.(time.Duration)
+		ok = arg == nil || (k == durationArg && isDuration)
+	case nodeArg:
+		_, ok = arg.(Node)
+	case noteArg:
+		_, isNote := arg.(Note)
+		ok = arg == nil || isNote
+	case clockArg:
+		_, ok = arg.(*Clock)
+	case routeArg:
+		_, ok = arg.(*modRoute)
+	}
+	if !ok {
+		return fmt.Errorf("Arg %T isn't a %s", arg, k)
+	}
+	return nil
+}
+
+//
+//
+//
+
+// An EventSpec declares an Event type: what its Value and Arg must be, and
+// which kinds of Node accept it. Parameterized types, like gain:<input>,
+// have a param function which validates the part after the colon.
+type EventSpec struct {
+	Type  string
+	Value valueKind
+	Arg   argKind
+	Kinds []string // as given by Kind(); none means every Node
+	param func(string) error
+}
+
+// key returns the EventSpec's key in the registry: its type, followed by a
+// colon if it's parameterized. A type may be registered both ways.
+func (s EventSpec) key() string {
+	if s.param != nil {
+		return s.Type + ":"
+	}
+	return s.Type
+}
+
+// eventRegistry holds every Event type a Node may receive, by key.
+// It's only written during initialization.
+var eventRegistry = map[string]EventSpec{}
+
+// registerEvent adds the EventSpec to the registry.
+func registerEvent(spec EventSpec) {
+	if _, ok := eventRegistry[spec.key()]; ok {
+		panic(fmt.Sprintf("Event type %s registered twice", spec.key()))
+	}
+	eventRegistry[spec.key()] = spec
+}
+
+// EventTypes returns every registered Event type, in order. Parameterized
+// types are followed by a colon.
+func EventTypes() []string {
+	types := make([]string, 0, len(eventRegistry))
+	for key := range eventRegistry {
+		types = append(types, key)
+	}
+	sort.Strings(types)
+	return types
+}
+
+var (
+	errUnknownEvent = errors.New("unknown Event type")
+	errNotAccepted  = errors.New("not accepted by this kind of Node")
+)
+
+// LookupEvent returns the EventSpec of the Event type, and its parameter,
+// if it's a parameterized type. It doesn't validate the parameter.
+func LookupEvent(typ string) (EventSpec, string, error) {
+	key, param := typ, ""
+	if i := strings.IndexByte(typ, ':'); i >= 0 {
+		key, param = typ[:i+1], typ[i+1:]
+	}
+	spec, ok := eventRegistry[key]
+	if !ok {
+		return EventSpec{}, "", errUnknownEvent
+	}
+	return spec, param, nil
+}
+
+// ValidateEvent returns an error if the Event's type isn't registered, or
+// its parameter, Value or Arg don't match its EventSpec.
+func ValidateEvent(ev Event) error {
+	spec, param, err := LookupEvent(ev.Type)
+	if err != nil {
+		return err
+	}
+	if spec.param != nil {
+		if err := spec.param(param); err != nil {
+			return err
+		}
+	}
+	if err := spec.Value.check(ev.Value); err != nil {
+		return err
+	}
+	return spec.Arg.check(ev.Arg)
+}
+
+// An eventBuffer accepts Events of every type, to pass them on later.
+type eventBuffer interface {
+	buffersEvents()
+}
+
+// AcceptedBy returns true if Nodes like n accept Events of the type.
+func (s EventSpec) AcceptedBy(n Node) bool {
+	if len(s.Kinds) <= 0 {
+		return true
+	}
+	if _, ok := n.(eventBuffer); ok {
+		return true
+	}
+	typed, ok := n.(Typed)
+	if !ok {
+		return false
+	}
+	kind := typed.Kind()
+	for _, k := range s.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptEvent returns an error if the Node doesn't accept Events of the
+// type. It's called on the audio path, so it doesn't allocate.
+func acceptEvent(n Node, ev Event) error {
+	spec, _, err := LookupEvent(ev.Type)
+	if err != nil {
+		return err
+	}
+	if !spec.AcceptedBy(n) {
+		return errNotAccepted
+	}
+	return nil
+}
+
+//
+//
+//
+
+// oneOf returns a param function accepting only the given parameters.
+func oneOf(params ...string) func(string) error {
+	return func(p string) error {
+		for _, q := range params {
+			if p == q {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q isn't one of %s", p, strings.Join(params, ", "))
+	}
+}
+
+// nonEmpty is a param function accepting any parameter but none.
+func nonEmpty(p string) error {
+	if p == "" {
+		return fmt.Errorf("missing parameter")
+	}
+	return nil
+}
+
+// eventType is a param function accepting registered, unparameterized
+// Event types.
+func eventType(p string) error {
+	if _, ok := eventRegistry[p]; !ok {
+		return fmt.Errorf("%q: %s", p, errUnknownEvent)
+	}
+	return nil
+}
+
+// stepNumber is a param function accepting step numbers of a ModStep.
+func stepNumber(p string) error {
+	if i, err := strconv.Atoi(p); err != nil || i < 1 || i > maxSteps {
+		return fmt.Errorf("%q isn't a step from 1 to %d", p, maxSteps)
+	}
+	return nil
+}
+
+// timeSignature is a param function accepting TimeSignatures, eg. 7/8.
+func timeSignature(p string) error {
+	_, err := ParseTimeSignature(p)
+	return err
+}
+
+// rampLength is a param function accepting a RampLength.
+func rampLength(p string) error {
+	_, err := ParseRampLength(p)
+	return err
+}
+
+// gridName is a param function accepting the grids of a quantizer.
+func gridName(p string) error {
+	_, err := parseGrid(p)
+	return err
+}
+
+var (
+	quantizedKinds = []string{"synchronizer", "Looper", "Modulation Step"}
+	generatorKinds = []string{"Sine Generator"}
+	envelopeKinds  = []string{"ADSR", "Modulation Envelope"}
+	modSourceKinds = []string{"Modulation LFO", "Modulation Envelope", "Modulation Random", "Modulation Step"}
+	modulatedKinds = []string{"Sine Generator", "gain LFO", "Delay", "Echo", "Crossfade"}
+	keyKinds       = append(append([]string{}, generatorKinds...), envelopeKinds...)
+)
+
+func init() {
+	for _, spec := range []EventSpec{
+		// graph
+		{Type: Connect, Arg: nodeArg},
+		{Type: Disconnect, Arg: nodeArg},
+		{Type: Connection, Arg: nodeArg},
+		{Type: Disconnection, Arg: nodeArg},
+		{Type: Kill},
+
+		// time
+		{Type: Tick, Value: anyValue, Arg: clockArg, Kinds: []string{"synchronizer", "Looper", "Modulation Step"}},
+		{Type: BPM, Value: positive, Kinds: []string{"Clock"}},
+		{Type: Ramp, Value: positive, Kinds: []string{"Clock"}, param: rampLength},
+		{Type: PPQN, Value: countValue, Kinds: []string{"Clock"}},
+		{Type: TimeSig, Kinds: []string{"Clock"}, param: timeSignature},
+		{Type: Mod, Value: countValue, Kinds: quantizedKinds},
+		{Type: Quantize, Kinds: quantizedKinds, param: gridName},
+		{Type: Grooved, Value: unitValue, Kinds: quantizedKinds},
+
+		// notes and generators
+		{Type: KeyDown, Value: nonNegative, Arg: noteArg, Kinds: keyKinds},
+		{Type: KeyUp, Value: nonNegative, Arg: noteArg, Kinds: keyKinds},
+		{Type: Pitch, Value: nonNegative, Arg: noteArg, Kinds: generatorKinds},
+		{Type: Hz, Value: nonNegative, Kinds: []string{"Sine Generator", "gain LFO", "Modulation LFO", "Modulation Random"}},
+		{Type: Bend, Value: anyValue, Kinds: append([]string{"ADSR"}, generatorKinds...)},
+		{Type: Pressure, Value: unitValue, Kinds: append([]string{"ADSR"}, generatorKinds...)},
+		{Type: Glide, Value: msValue, Arg: durationArg, Kinds: generatorKinds},
+		{Type: Gain, Value: nonNegative, Kinds: []string{"Sine Generator", "Audio Input", "Mixer"}},
+		{Type: Gain, Value: nonNegative, Kinds: []string{"Sum"}, param: nonEmpty},
+
+		// effects
+		{Type: "min", Value: anyValue, Kinds: []string{"gain LFO", "Envelope Follower"}},
+		{Type: "max", Value: anyValue, Kinds: []string{"gain LFO", "Envelope Follower"}},
+		{Type: LoopDelay, Value: delayValue, Kinds: []string{"Delay", "Echo"}},
+		{Type: "wet", Value: unitValue, Kinds: []string{"Echo"}},
+		{Type: Mix, Value: unitValue, Kinds: []string{"Crossfade"}},
+		{Type: Size, Value: countValue, Kinds: []string{"Analyzer"}},
+
+		// envelopes
+		{Type: Attack, Value: msValue, Arg: durationArg, Kinds: append([]string{"Envelope Follower"}, envelopeKinds...)},
+		{Type: Decay, Value: msValue, Arg: durationArg, Kinds: envelopeKinds},
+		{Type: Sustain, Value: unitValue, Kinds: envelopeKinds},
+		{Type: Release, Value: msValue, Arg: durationArg, Kinds: append([]string{"Envelope Follower"}, envelopeKinds...)},
+		{Type: VelScale, Value: unitValue, Kinds: envelopeKinds},
+		{Type: Curve, Kinds: envelopeKinds, param: oneOf("linear", "lin", "exponential", "exp")},
+
+		// publishers
+		{Type: Param, Kinds: []string{"Envelope Follower"}, param: eventType},
+		{Type: Rate, Value: rateValue, Kinds: []string{"Envelope Follower"}},
+
+		// modulation
+		{Type: Route, Value: anyValue, Arg: routeArg, Kinds: modSourceKinds},
+		{Type: Unsubscribe, Arg: nodeArg, Kinds: modSourceKinds},
+		{Type: Modulate, Value: anyValue, Arg: routeArg, Kinds: modulatedKinds},
+		{Type: Shape, Kinds: []string{"Modulation LFO"}, param: oneOf("sine", "triangle", "square", "saw")},
+		{Type: Steps, Value: countValue, Kinds: []string{"Modulation Step"}},
+		{Type: Step, Value: unitValue, Kinds: []string{"Modulation Step"}, param: stepNumber},
+
+		// looper
+		{Type: Rec, Kinds: []string{"Looper"}},
+		{Type: Overdub, Kinds: []string{"Looper"}},
+		{Type: Play, Kinds: []string{"Looper"}},
+		{Type: Stop, Kinds: []string{"Looper"}},
+		{Type: Undo, Kinds: []string{"Looper"}},
+		{Type: Halve, Kinds: []string{"Looper"}},
+		{Type: Double, Kinds: []string{"Looper"}},
+		{Type: Reverse, Kinds: []string{"Looper"}},
+		{Type: Clear, Kinds: []string{"Looper"}},
+		{Type: Beats, Value: countValue, Kinds: []string{"Looper"}},
+	} {
+		registerEvent(spec)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateEvent(t *testing.T) {
+	for _, tc := range []struct {
+		ev Event
+		ok bool
+	}{
+		{Event{Gain, 0.5, nil, 0}, true},
+		{Event{Gain, -0.5, nil, 0}, false},
+		{Event{"gain:a", 0.5, nil, 0}, true},
+		{Event{"gain:", 0.5, nil, 0}, false},
+		{Event{"nonsense", 0, nil, 0}, false},
+		{Event{Sustain, 1, nil, 0}, true},
+		{Event{Sustain, 1.5, nil, 0}, false},
+		{Event{Attack, 10, nil, 0}, true},
+		{Event{Attack, -10, 10 * time.Millisecond, 0}, false},
+		{Event{Attack, 0, 10 * time.Millisecond, 0}, true},
+		{Event{Attack, 0, "10ms", 0}, false},
+		{Event{KeyDown, 1, nil, 0}, true},
+		{Event{KeyDown, 1, NoteZero(), 0}, true},
+		{Event{KeyDown, 1, time.Second, 0}, false},
+		{Event{Tick, 0, nil, 0}, false},
+		{Event{Tick, 0, &Clock{}, 0}, true},
+		{Event{Connect, 0, nil, 0}, false},
+		{Event{Connect, 0, NewMixer(), 0}, true},
+		{Event{LoopDelay, maxDelay, nil, 0}, true},
+		{Event{LoopDelay, maxDelay + 1, nil, 0}, false},
+		{CurveEvent("exp"), true},
+		{CurveEvent("square"), false},
+	} {
+		if err := ValidateEvent(tc.ev); (err == nil) != tc.ok {
+			t.Errorf("%s %v: %v", tc.ev.Type, tc.ev, err)
+		}
+	}
+}
+
+func TestAcceptEvent(t *testing.T) {
+	for _, tc := range []struct {
+		node Node
+		typ  string
+		err  error
+	}{
+		{NewADSR("a"), Attack, nil},
+		{NewADSR("a"), KeyDown, nil},
+		{NewDelay("d"), Attack, errNotAccepted},
+		{NewDelay("d"), LoopDelay, nil},
+		{NewEcho("e"), LoopDelay, nil},
+		{NewMixer(), Gain, nil},
+		{NewMixer(), "nonsense", errUnknownEvent},
+		{NewADSR("a"), Kill, nil}, // every Node
+	} {
+		if err := acceptEvent(tc.node, Event{tc.typ, 0, nil, 0}); err != tc.err {
+			t.Errorf("%s -> %s: %v, want %v", tc.typ, tc.node.Name(), err, tc.err)
+		}
+	}
+
+	n, ev := NewADSR("a"), Event{Attack, 10, nil, 0}
+	if allocs := testing.AllocsPerRun(100, func() { acceptEvent(n, ev) }); allocs > 0 {
+		t.Errorf("%.0f allocations accepting an Event", allocs)
+	}
+}
+
+// Every kind of Node named in the registry must exist, or its Events would
+// be rejected by every Node.
+func TestRegisteredKindsExist(t *testing.T) {
+	kinds := map[string]bool{NewMixer().Kind(): true, NewClock(NewField()).Kind(): true}
+	for name, create := range createInstanceMap {
+		if typed, ok := create(name).(Typed); ok {
+			kinds[typed.Kind()] = true
+		}
+	}
+	for key, spec := range eventRegistry {
+		for _, k := range spec.Kinds {
+			if !kinds[k] {
+				t.Errorf("%s: no Node is a %s", key, k)
+			}
+		}
+	}
+}
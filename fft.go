@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// fft computes the discrete Fourier transform of x in-place, via the
+// iterative radix-2 Cooley-Tukey algorithm. len(x) must be a power of 2.
+func fft(x []complex128) {
+	n := len(x)
+
+	// bit-reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*wk
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wk *= w
+			}
+		}
+	}
+}
+
+// hann returns the Hann window coefficient for sample i of n.
+func hann(i, n int) float64 {
+	return 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+}
+
+func isPowerOf2(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
@@ -2,63 +2,117 @@ package main
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 )
 
-type Field map[string]Node
+// A Field is the set of Nodes, and the connections between them,
+// which is rendered by the Engine. Changes to the Field are made by
+// sending Events to Nodes; holding the Field's lock while sending
+// guarantees the Engine will deliver all of them in the same block.
+type Field struct {
+	frames int64 // rendered; accessed atomically, so it comes first
+
+	sync.Mutex
+	nodes    map[string]Node
+	reaped   []Node // deleted, but awaiting final Events
+	changed  bool   // Nodes added or deleted since the last render
+	annotate func(Node) string
+	bus      eventBus
+}
 
-func NewField() Field {
-	return map[string]Node{}
+func NewField() *Field {
+	return &Field{
+		nodes: map[string]Node{},
+		bus:   makeEventBus(),
+	}
 }
 
-func (f Field) Add(n Node) error {
+// Now returns the number of frames the Engine has rendered. It's the frame
+// at which the next block begins, in the timeline of Event times.
+func (f *Field) Now() int64 { return atomic.LoadInt64(&f.frames) }
+
+// elapse advances the timeline by the frames of a rendered block.
+func (f *Field) elapse(frames int) { atomic.AddInt64(&f.frames, int64(frames)) }
+
+func (f *Field) Add(n Node) error {
 	defer writeDotfile(f)
+	f.Lock()
+	defer f.Unlock()
 	name := n.Name()
-	if n, _ := f.Get(name); n != nil {
+	if _, ok := f.nodes[name]; ok {
 		return fmt.Errorf("already exists")
 	}
-	f[name] = n
+	f.nodes[name] = n
+	f.changed = true
+	if sub, ok := n.(busSubscriber); ok {
+		for _, typ := range sub.subscriptions() {
+			f.bus.subscribe(n, typ)
+		}
+	}
+	if p, ok := n.(publisher); ok {
+		p.publishTo(f, n)
+	}
 	return nil
 }
 
-func (f Field) Get(name string) (Node, error) {
-	if n, ok := f[name]; ok {
+func (f *Field) Get(name string) (Node, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.get(name)
+}
+
+func (f *Field) get(name string) (Node, error) {
+	if n, ok := f.nodes[name]; ok {
 		return n, nil
 	}
 	return nil, fmt.Errorf("not found")
 }
 
-func (f Field) Delete(name string) error {
+func (f *Field) Delete(name string) error {
 	defer writeDotfile(f)
-	n, err := f.Get(name)
+	f.Lock()
+	defer f.Unlock()
+	n, err := f.get(name)
 	if err != nil {
 		return fmt.Errorf("not found")
 	}
 
 	for _, parent := range n.Parents() {
-		if err := f.Disconnect(parent.Name(), name); err != nil {
+		if err := f.disconnect(parent.Name(), name); err != nil {
 			panic(fmt.Errorf("delete(%s): %s", name, err))
 		}
 	}
 	for _, child := range n.Children() {
-		if err := f.Disconnect(name, child.Name()); err != nil {
+		if err := f.disconnect(name, child.Name()); err != nil {
 			panic(fmt.Errorf("delete(%s): %s", name, err))
 		}
 	}
 
-	n.Events() <- KillEvent()
-	delete(f, name)
+	n.Send(KillEvent())
+	delete(f.nodes, name)
+	f.bus.remove(n)
+	for _, other := range f.nodes {
+		if _, ok := other.(modulator); ok {
+			other.Send(UnsubscribeEvent(n))
+		}
+	}
+	f.reaped = append(f.reaped, n)
+	f.changed = true
 	return nil
 }
 
-func (f Field) Connect(src, dst string) error {
+func (f *Field) Connect(src, dst string) error {
 	D("Connect(%s, %s)", src, dst)
 	defer writeDotfile(f)
-	parent, err := f.Get(src)
+	f.Lock()
+	defer f.Unlock()
+	parent, err := f.get(src)
 	if err != nil {
 		return err
 	}
 
-	child, err := f.Get(dst)
+	child, err := f.get(dst)
 	if err != nil {
 		return err
 	}
@@ -67,15 +121,21 @@ func (f Field) Connect(src, dst string) error {
 		return fmt.Errorf("cycle detected")
 	}
 
-	parent.Events() <- ConnectEvent(child)
-	child.Events() <- ConnectionEvent(parent)
+	parent.Send(ConnectEvent(child))
+	child.Send(ConnectionEvent(parent))
 
 	return nil
 }
 
-func (f Field) Disconnect(src, dst string) error {
+func (f *Field) Disconnect(src, dst string) error {
 	defer writeDotfile(f)
-	parent, err := f.Get(src)
+	f.Lock()
+	defer f.Unlock()
+	return f.disconnect(src, dst)
+}
+
+func (f *Field) disconnect(src, dst string) error {
+	parent, err := f.get(src)
 	if err != nil {
 		return err
 	}
@@ -91,55 +151,84 @@ func (f Field) Disconnect(src, dst string) error {
 		return fmt.Errorf("'%s' not a child of '%s'", dst, src)
 	}
 
-	parent.Events() <- DisconnectEvent(child)
-	child.Events() <- DisconnectionEvent(parent)
+	parent.Send(DisconnectEvent(child))
+	child.Send(DisconnectionEvent(parent))
 
 	return nil
 }
 
-func (f Field) DisconnectAll(src string) error {
+func (f *Field) DisconnectAll(src string) error {
 	defer writeDotfile(f)
-	parent, err := f.Get(src)
+	f.Lock()
+	defer f.Unlock()
+	parent, err := f.get(src)
 	if err != nil {
 		return err
 	}
 
 	for _, child := range parent.Children() {
-		parent.Events() <- DisconnectEvent(child)
-		child.Events() <- DisconnectionEvent(parent)
+		parent.Send(DisconnectEvent(child))
+		child.Send(DisconnectionEvent(parent))
 	}
 
 	return nil
 }
 
-func (f Field) Broadcast(ev Event) {
-	for _, n := range f {
-		n.Events() <- ev
-	}
+// Annotate sets a function which provides extra text for the label of each
+// Node in the Dot representation, eg. its current level.
+func (f *Field) Annotate(annotate func(Node) string) {
+	f.Lock()
+	defer f.Unlock()
+	f.annotate = annotate
 }
 
 func (f *Field) Dot() string {
+	f.Lock()
+	defer f.Unlock()
 	s := "digraph G {\n"
 
 	// nodes
-	for _, n := range *f {
+	for _, n := range f.nodes {
+		label := NodeLabel(n)
+		if f.annotate != nil {
+			if a := f.annotate(n); a != "" {
+				label += "\\n" + a
+			}
+		}
 		s += fmt.Sprintf(
 			"\t%s [shape=box,label=\"%s\"];\n",
 			n.Name(),
-			NodeLabel(n),
+			label,
 			//n,
 		)
 	}
 	s += "\n"
 
 	// edges
-	for _, n := range *f {
+	for _, n := range f.nodes {
 		D("Dot: adding edges for %d children of %s", len(n.Children()), n.Name())
 		for _, child := range n.Children() {
 			s += fmt.Sprintf("\t%s -> %s;\n", n.Name(), child.Name())
 		}
 	}
 
+	// modulation
+	for _, n := range f.nodes {
+		m, ok := n.(modulator)
+		if !ok {
+			continue
+		}
+		for _, r := range m.modRoutes() {
+			s += fmt.Sprintf(
+				"\t%s -> %s [style=dashed,label=\"%s %+.2f\"];\n",
+				n.Name(),
+				r.target.Name(),
+				r.param,
+				r.depth,
+			)
+		}
+	}
+
 	s += "}"
 	return s
 }
@@ -223,7 +312,7 @@ func (sp *singleParent) processEvent(ev Event, container Node) {
 			// This means x=>a, y=>a has been executed without an intermediate
 			// x≠>a. Since we have only one parent, the original necessarily
 			// must be disconnected.
-			sp.ParentNode.Events() <- DisconnectEvent(container)
+			sp.ParentNode.Send(DisconnectEvent(container))
 		}
 		sp.ParentNode = node
 
@@ -258,7 +347,7 @@ func (sc *singleChild) processEvent(ev Event, container Node) {
 			// This means a=>b, a=>c has been executed without an intermediate
 			// a≠>b. Since we have only one child, the original necessarily
 			// must be disconnected.
-			sc.ChildNode.Events() <- DisconnectionEvent(container)
+			sc.ChildNode.Send(DisconnectionEvent(container))
 		}
 		sc.ChildNode = node
 
@@ -291,28 +380,40 @@ func (sa *singleAncestry) processEvent(ev Event, container Node) {
 
 // multipleParents may be embedded into any type to satisfy
 // the Parents() method of the Node interface, with arity=N.
-type multipleParents struct{ m map[string]Node }
+// Parents are returned in the order they were connected.
+type multipleParents struct{ nodes []Node }
 
 func newMultipleParents() *multipleParents {
 	return &multipleParents{
-		m: map[string]Node{},
+		nodes: []Node{},
 	}
 }
 
 func (mp *multipleParents) Parents() []Node {
-	parents := []Node{}
-	for _, n := range mp.m {
-		parents = append(parents, n)
-	}
+	parents := make([]Node, len(mp.nodes))
+	copy(parents, mp.nodes)
 	return parents
 }
 
+// AddParent appends n to the list of parents. Adding a parent which
+// already exists (by name) replaces it, but keeps its position.
 func (mp *multipleParents) AddParent(n Node) {
-	mp.m[n.Name()] = n
+	for i, parent := range mp.nodes {
+		if parent.Name() == n.Name() {
+			mp.nodes[i] = n
+			return
+		}
+	}
+	mp.nodes = append(mp.nodes, n)
 }
 
 func (mp *multipleParents) DeleteParent(name string) {
-	delete(mp.m, name)
+	for i, parent := range mp.nodes {
+		if parent.Name() == name {
+			mp.nodes = append(mp.nodes[:i], mp.nodes[i+1:]...)
+			return
+		}
+	}
 }
 
 // noParents may be embedded into any type to satisfy
@@ -3,54 +3,28 @@ package main
 import (
 	"fmt"
 	"math"
+	"time"
 )
 
 const (
-	SRATE             = 44100 // audio sample rate
-	BUFSZ             = 2048  // audio buffer size
-	AUDIO_CHAN_BUFFER = 0     // unbuffered
-	EVENT_CHAN_BUFFER = 10
+	KeyDown  = "keydown"
+	KeyUp    = "keyup"
+	Gain     = "gain"
+	Hz       = "hz"
+	Glide    = "glide"
+	Bend     = "bend"
+	Pressure = "pressure"
 )
 
-// generatorChannels are designed to be embedded into Generators
-// to satisfy the Node and AudioSender interfaces.
-type generatorChannels struct {
-	eventIn  chan Event
-	audioOut chan []float32
-}
-
-func (gc *generatorChannels) Events() chan<- Event {
-	return gc.eventIn
-}
-
-func (gc *generatorChannels) AudioOut() <-chan []float32 {
-	return gc.audioOut
-}
-
-func (gc *generatorChannels) Reset() {
-	close(gc.audioOut)
-	gc.audioOut = make(chan []float32, AUDIO_CHAN_BUFFER)
-}
-
-func makeGeneratorChannels() generatorChannels {
-	ei := make(chan Event, EVENT_CHAN_BUFFER)
-	ao := make(chan []float32, AUDIO_CHAN_BUFFER)
-	return generatorChannels{ei, ao}
-}
-
-//
-//
-//
+func KeyDownEvent(n Note) Event { return Event{KeyDown, n.Hz(), n, 0} }
+func KeyUpEvent(n Note) Event   { return Event{KeyUp, n.Hz(), n, 0} }
+func GainEvent(g float32) Event { return Event{Gain, g, nil, 0} }
 
-const (
-	KeyDown = "keydown"
-	KeyUp   = "keyup"
-	Gain    = "gain"
-)
+// BendEvent bends the pitch of the sounding Note, in semitones.
+func BendEvent(semitones float32) Event { return Event{Bend, semitones, nil, 0} }
 
-func KeyDownEvent(n Note) Event { return Event{KeyDown, n.Hz(), n} }
-func KeyUpEvent(n Note) Event   { return Event{KeyUp, n.Hz(), n} }
-func GainEvent(g float32) Event { return Event{Gain, g, nil} }
+// PressureEvent changes the pressure on the sounding Note, in [0 .. 1].
+func PressureEvent(p float32) Event { return Event{Pressure, p, nil, 0} }
 
 // simpleParameters are sufficient to control simple,
 // single-mode Generators.
@@ -58,6 +32,16 @@ type simpleParameters struct {
 	hz    float32
 	phase float32 // 0..1
 	gain  float32 // 0..1
+
+	hzMod   float32 // modulation offsets
+	gainMod float32
+
+	velocity float32 // of the sounding Note
+	bend     float32 // semitones
+	pressure float32
+
+	glide        time.Duration // portamento between KeyDowns
+	hzIn, gainIn smoothed      // in effect
 }
 
 // processEvent satisfies the eventProcessor interface.
@@ -66,15 +50,72 @@ func (sp *simpleParameters) processEvent(ev Event) {
 	switch ev.Type {
 	case KeyDown:
 		sp.hz = ev.Value
+		sp.velocity, sp.bend, sp.pressure = 1.0, 0.0, 0.0
+		if n, ok := ev.Arg.(velocityNote); ok {
+			sp.velocity = n.Velocity()
+		}
+		if n, ok := ev.Arg.(expressiveNote); ok {
+			sp.bend, sp.pressure = n.Bend(), n.Pressure()
+		}
+		sp.update(true)
+	case Pitch, Hz:
+		sp.hz = ev.Value
+		sp.update(false)
+	case Bend:
+		sp.bend = ev.Value
+		sp.update(false)
+	case Pressure:
+		sp.pressure = ev.Value
+		sp.update(false)
 	case KeyUp:
 		sp.hz = 0.0
+		sp.update(false)
 	case Gain:
 		sp.gain = ev.Value
+		sp.update(false)
+	case Glide:
+		sp.glide = eventDuration(ev, sp.glide)
 	}
 }
 
 func makeSimpleParameters() simpleParameters {
-	return simpleParameters{0.0, 0.0, 1.0}
+	return simpleParameters{
+		gain:     1.0,
+		velocity: 1.0,
+		gainIn:   makeSmoothed(1.0),
+	}
+}
+
+// update moves the hz and gain in effect towards their set values, plus
+// modulation and the expression of the sounding Note. Bend transposes, and
+// pressure swells the Note from the loudness of its velocity to full. With
+// a glide, each KeyDown slides from the previous note; notes starting from
+// silence, or ending in it, don't slide.
+func (sp *simpleParameters) update(keyDown bool) {
+	hz := sp.hz + sp.hzMod
+	if hz < 0.0 {
+		hz = 0.0
+	}
+	if sp.bend != 0.0 {
+		hz *= float32(math.Pow(2, float64(sp.bend)/12))
+	}
+	loudness := sp.velocity + (1-sp.velocity)*sp.pressure
+	d, m := Smoothing()
+	switch {
+	case hz == 0.0 || sp.hzIn.value == 0.0:
+		sp.hzIn.jump(hz)
+	case keyDown && sp.glide > 0:
+		sp.hzIn.glide(hz, sp.glide, m)
+	default:
+		sp.hzIn.glide(hz, d, m)
+	}
+	sp.gainIn.glide((sp.gain+sp.gainMod)*loudness, d, m)
+}
+
+// nextParameters returns the hz and gain in effect for the next frame,
+// including modulation.
+func (sp *simpleParameters) nextParameters() (float32, float32) {
+	return sp.hzIn.next(), sp.gainIn.next()
 }
 
 //
@@ -90,14 +131,11 @@ type valueProvider interface {
 	nextValue() float32
 }
 
-// nextBuffer aggregates BUFSZ values from the valueProvider
-// into a single buffer, which it then returns.
-func nextBuffer(vp valueProvider) []float32 {
-	buf := make([]float32, BUFSZ)
-	for i := 0; i < BUFSZ; i++ {
+// nextBuffer fills the buffer with values from the valueProvider.
+func nextBuffer(vp valueProvider, buf []float32) {
+	for i := range buf {
 		buf[i] = vp.nextValue()
 	}
-	return buf
 }
 
 //
@@ -108,10 +146,10 @@ func nextBuffer(vp valueProvider) []float32 {
 // We scale that to the range [0 .. 0.25]. Call that scaled output
 // 'F'. We generate a waveform based on phase [0 .. 1] as follows:
 //
-//    phase < 0.25: output = F
-//    phase < 0.50: output = F mirrored horizontally
-//    phase < 0.75: output = F mirrored vertically
-//    phase < 1.00: output = F mirrored horizontally + vertically
+//	phase < 0.25: output = F
+//	phase < 0.50: output = F mirrored horizontally
+//	phase < 0.75: output = F mirrored vertically
+//	phase < 1.00: output = F mirrored horizontally + vertically
 //
 // (Thanks to Alexander Surma for the idea on this one.)
 type GeneratorFunction func(float32) float32
@@ -134,7 +172,7 @@ func nextGeneratorFunctionValue(f GeneratorFunction, hz float32, phase *float32)
 	default:
 		panic("unreachable")
 	}
-	*phase += hz / SRATE
+	*phase += hz / float32(config.SampleRate)
 	if *phase > 1.0 {
 		*phase -= 1.0
 	}
@@ -165,17 +203,26 @@ func square(x float32) float32 {
 // using only simpleParameters. Handily, this describes a large class of
 // generators.
 //
-// A simpleGenerator also claims singleAncestry; that is,
-// it has up to 1 parent and 1 child Node in the Field.
+// A simpleGenerator has no parents, and up to 1 child Node in the Field.
 type simpleGenerator struct {
-	generatorChannels
+	mailbox
+	audioOutput
 	simpleParameters
+	modulated
 
 	nodeName
 	singleChild
 	noParents
 }
 
+func makeSimpleGenerator(name string) simpleGenerator {
+	return simpleGenerator{
+		audioOutput:      makeAudioOutput(),
+		simpleParameters: makeSimpleParameters(),
+		nodeName:         nodeName(name),
+	}
+}
+
 func (g *simpleGenerator) String() string {
 	return fmt.Sprintf(
 		"<Hz=%.2f gain=%.2f Parents=%d Children=%d>",
@@ -186,66 +233,33 @@ func (g *simpleGenerator) String() string {
 	)
 }
 
-// generatorLoop is the common function that should drive all Generators
-// which contain generatorChannels and are driven by simpleParameters.
+// modulatable satisfies the modulatable interface.
+func (sg *simpleGenerator) modulatable() []string { return []string{Hz, Gain} }
+
+// processEvent satisfies the eventProcessor interface for all Generators
+// which are driven by simpleParameters.
 //
 // It processes certain common Event types, and passes the remaining Events
-// off to the given simpleParameters.
-//
-// It uses the passed valueProvider (typically the concrete Generator itself)
-// to generate audio buffers which are pushed over the outgoing audio channel.
-func (sg *simpleGenerator) loop(vp valueProvider) {
-	var buf []float32 = nil
-	for {
-		if buf == nil {
-			buf = nextBuffer(vp)
-		}
-		select {
-		case sg.generatorChannels.audioOut <- buf:
-			buf = nil
-
-		case ev := <-sg.generatorChannels.eventIn:
-			switch ev.Type {
-			case Connection, Disconnection:
-				D("simpleGenerator got ignored %s Event", ev.Type)
-				break // no parents: ignore
-
-			case Connect:
-				n, ok := ev.Arg.(Node)
-				if !ok {
-					panic("simpleGenerator Connect to non-Node")
-				}
-				// This is tentatively commented-out, because the scheduler
-				// may cause it to be executed *after* the downstream node has
-				// already called our AudioOut() and started consuming.
-				//
-				//sg.generatorChannels.Reset()
-				//
-				// UPDATE
-				// Unfortunately, without a signal to the original downstream
-				// Node, it will continue to attempt to receive audio from an
-				// abandoned channel. Since we can't guarantee order of
-				// evaluation of Connect signals, we need the Connect action
-				// to propegate a Disconnection signal to the original Node
-				// in single-ancestry situations.
-				sg.ChildNode = n
-				D("simpleGenerator got Connect %s OK", n.Name())
-
-			case Disconnect:
-				sg.ChildNode = nilNode
-				sg.generatorChannels.Reset()
-				D("simpleGenerator got Disconnect OK")
-
-			case Kill:
-				sg.ChildNode = nilNode
-				sg.generatorChannels.Reset()
-				return
-
-			default:
-				sg.simpleParameters.processEvent(ev)
-			}
+// off to the simpleParameters.
+func (sg *simpleGenerator) processEvent(ev Event) {
+	switch ev.Type {
+	case Connection, Disconnection:
+		D("simpleGenerator got ignored %s Event", ev.Type)
+		break // no parents: ignore
 
-		}
+	case Connect, Disconnect:
+		sg.singleChild.processEvent(ev, sg)
+
+	case Kill:
+		sg.ChildNode = nilNode
+
+	case Modulate:
+		sg.modulate(ev)
+		sg.hzMod, sg.gainMod = sg.offset(Hz), sg.offset(Gain)
+		sg.update(false)
+
+	default:
+		sg.simpleParameters.processEvent(ev)
 	}
 }
 
@@ -263,15 +277,7 @@ func (g *SineGenerator) String() string {
 }
 
 func NewSineGenerator(name string) *SineGenerator {
-	g := SineGenerator{
-		simpleGenerator{
-			generatorChannels: makeGeneratorChannels(),
-			simpleParameters:  makeSimpleParameters(),
-			nodeName:          nodeName(name),
-		},
-	}
-	go g.simpleGenerator.loop(&g)
-	return &g
+	return &SineGenerator{makeSimpleGenerator(name)}
 }
 
 func NewSineGeneratorNode(name string) Node {
@@ -281,5 +287,6 @@ func NewSineGeneratorNode(name string) Node {
 // nextValue for a SineGenerator will output a pure sine waveform at the
 // frequency described by the simpleParameter's hz parameter.
 func (g *SineGenerator) nextValue() float32 {
-	return nextGeneratorFunctionValue(sine, g.hz, &g.phase) * g.gain
+	hz, gain := g.nextParameters()
+	return nextGeneratorFunctionValue(sine, hz, &g.phase) * gain
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	Grooved = "grooved" // 0 opts a Node out of the Clock's Groove, 1 back in
+)
+
+// A Groove makes the Clock less even. It divides time into steps of a note
+// value, eg. sixteenths, and repeats a pattern over them: each step is
+// moved by a fraction of its length, and Notes released on it are played
+// louder or softer. Ticks between the steps are spread evenly between
+// where the steps fall.
+type Groove struct {
+	Name  string
+	Value int          // of each step, as a note value; a quarter note is 4
+	Steps []grooveStep // repeated from the Clock's first Tick
+}
+
+// A grooveStep is the change a Groove makes to one step.
+type grooveStep struct {
+	Timing   float64 // fraction of a step, in [-0.5 .. 0.5]; positive is late
+	Velocity float32 // added to Notes' velocity, in [-1 .. 1]
+}
+
+// SwingGroove returns the Groove of swing: pairs of steps of the note value
+// in which the first takes the percentage of the pair, from 50 (straight)
+// to 75 (dotted).
+func SwingGroove(percent float64, value int) (*Groove, error) {
+	if percent < 50 || percent > 75 {
+		return nil, fmt.Errorf("swing %.0f%% isn't from 50%% to 75%%", percent)
+	}
+	if !isNoteValue(value) {
+		return nil, fmt.Errorf("%d isn't a note value from 1 to 32", value)
+	}
+	return &Groove{
+		Name:  fmt.Sprintf("swing %.0f%%", percent),
+		Value: value,
+		Steps: []grooveStep{{0, 0}, {(percent - 50) / 50, 0}},
+	}, nil
+}
+
+// ParseGroove parses a Groove, from a note value and its steps, each
+// written <timing>[@<velocity>], eg. 16 0 0.1@-0.2 0 0.15@-0.1.
+func ParseGroove(name string, value string, steps []string) (*Groove, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || !isNoteValue(v) {
+		return nil, fmt.Errorf("%s isn't a note value from 1 to 32", value)
+	}
+	if len(steps) < 1 {
+		return nil, fmt.Errorf("no steps")
+	}
+	g := &Groove{Name: name, Value: v}
+	for _, s := range steps {
+		toks := strings.SplitN(s, "@", 2)
+		timing, err := strconv.ParseFloat(toks[0], 64)
+		if err != nil || timing < -0.5 || timing > 0.5 {
+			return nil, fmt.Errorf("%s: timing isn't in [-0.5 .. 0.5]", s)
+		}
+		var velocity float64
+		if len(toks) == 2 {
+			velocity, err = strconv.ParseFloat(toks[1], 32)
+			if err != nil || velocity < -1 || velocity > 1 {
+				return nil, fmt.Errorf("%s: velocity isn't in [-1 .. 1]", s)
+			}
+		}
+		g.Steps = append(g.Steps, grooveStep{timing, float32(velocity)})
+	}
+	return g, nil
+}
+
+func (g *Groove) String() string {
+	steps := make([]string, len(g.Steps))
+	for i, s := range g.Steps {
+		steps[i] = strconv.FormatFloat(s.Timing, 'g', -1, 64)
+		if s.Velocity != 0 {
+			steps[i] += "@" + strconv.FormatFloat(float64(s.Velocity), 'g', -1, 32)
+		}
+	}
+	return fmt.Sprintf("%s: %d %s", g.Name, g.Value, strings.Join(steps, " "))
+}
+
+// step returns the step, of those of length n Ticks, in which Tick i falls,
+// and how far into it, from 0 to 1.
+func (g *Groove) step(i, n int) (int, float64) {
+	return i / n, float64(i%n) / float64(n)
+}
+
+func (g *Groove) at(k int) grooveStep { return g.Steps[k%len(g.Steps)] }
+
+// tickBeat returns where Tick i falls with the Groove, in quarter notes,
+// at the PPQN. If a step of the Groove isn't a whole number of Ticks, it
+// has no effect.
+func (g *Groove) tickBeat(i, ppqn int) float64 {
+	n := noteTicks(g.Value, ppqn)
+	if n <= 0 {
+		return float64(i) / float64(ppqn)
+	}
+	k, frac := g.step(i, n)
+	from := float64(k) + g.at(k).Timing
+	to := float64(k+1) + g.at(k+1).Timing
+	return (from + frac*(to-from)) * float64(n) / float64(ppqn)
+}
+
+// velocity returns the change to the velocity of Notes released on Tick i.
+func (g *Groove) velocity(i, ppqn int) float32 {
+	n := noteTicks(g.Value, ppqn)
+	if n <= 0 {
+		return 0
+	}
+	k, _ := g.step(i, n)
+	return g.at(k).Velocity
+}
+
+//
+//
+//
+
+// SetGroove makes the Clock play the Groove, from the next Tick. A nil
+// Groove is straight time.
+func (c *Clock) SetGroove(g *Groove) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.groove = g
+	if c.next >= 0 {
+		c.next = c.tickFrame(c.i)
+	}
+}
+
+// Groove returns the Groove the Clock is playing, or nil.
+func (c *Clock) Groove() *Groove {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.groove
+}
+
+// tickFrame returns the frame at which Tick i is broadcast: its frame on
+// the grid, moved by the Groove. The caller must hold the lock.
+func (c *Clock) tickFrame(i int) int64 {
+	if c.groove == nil {
+		return c.pulseFrame(i)
+	}
+	return c.frame(c.groove.tickBeat(i, c.ppqn))
+}
+
+// TickVelocity returns the change the Groove makes to the velocity of Notes
+// released on the Tick Event.
+func (c *Clock) TickVelocity(ev Event) float32 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.groove == nil {
+		return 0
+	}
+	return c.groove.velocity(int(ev.Value), c.ppqn)
+}
+
+// A grooveFollower is a subscriber to Ticks which may opt out of the
+// Clock's Groove.
+type grooveFollower interface {
+	followsGroove() bool
+}
+
+// broadcastTick sends the Tick, at its frame in the Groove, to every Node
+// subscribed to Ticks, except those which have opted out of the Groove:
+// they're sent it at its straight frame, on the grid.
+func (f *Field) broadcastTick(c *Clock, tick Event, straight int64) {
+	f.Lock()
+	defer f.Unlock()
+	for _, n := range f.bus.subs[Tick] {
+		if g, ok := n.(grooveFollower); ok && !g.followsGroove() {
+			n.Send(tick.Timed(straight))
+			continue
+		}
+		n.Send(tick)
+	}
+	f.bus.observe(c, nil, tick)
+}
+
+// accent returns the KeyDown Event, played with its velocity changed by v.
+// KeyDowns without a Note are given the nearest one.
+func accent(ev Event, v float32) Event {
+	n, ok := ev.Arg.(Note)
+	if !ok {
+		n, _ = NearestNote(ev.Value)
+	}
+	velocity, bend, pressure := float32(1), float32(0), float32(0)
+	if p, ok := n.(playedNote); ok {
+		n, velocity, bend, pressure = p.Note, p.velocity, p.bend, p.pressure
+	}
+	velocity = float32(math.Max(0, math.Min(1, float64(velocity+v))))
+	ev.Arg = PlayNote(n, velocity, bend, pressure)
+	return ev
+}
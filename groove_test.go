@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGrooveTickBeats(t *testing.T) {
+	swing := func(percent float64, value int) *Groove {
+		g, err := SwingGroove(percent, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	pushed, err := ParseGroove("pushed", "16", []string{"0", "-0.5", "0.25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		groove *Groove
+		ppqn   int
+		ticks  []int
+		beats  []float64
+	}{
+		{swing(50, 8), 24, []int{0, 6, 12, 18, 24}, []float64{0, 0.25, 0.5, 0.75, 1}},
+		{swing(200.0/3, 8), 24, []int{0, 6, 12, 18, 24, 36}, []float64{0, 1.0 / 3, 2.0 / 3, 5.0 / 6, 1, 5.0 / 3}},
+		{swing(75, 16), 24, []int{3, 6, 9, 12}, []float64{0.1875, 0.375, 0.4375, 0.5}},
+		{swing(75, 4), 24, []int{24, 48}, []float64{1.5, 2}},
+		{swing(75, 32), 4, []int{1, 2, 3}, []float64{0.25, 0.5, 0.75}}, // not a whole Tick: straight
+		{pushed, 4, []int{0, 1, 2, 3, 4}, []float64{0, 0.125, 0.5625, 0.75, 0.875}},
+	} {
+		for i, tick := range tc.ticks {
+			if got := tc.groove.tickBeat(tick, tc.ppqn); math.Abs(got-tc.beats[i]) > 1e-9 {
+				t.Errorf("%s at %d PPQN: Tick %d on beat %g, want %g",
+					tc.groove, tc.ppqn, tick, got, tc.beats[i])
+			}
+		}
+	}
+}
+
+func TestGrooveKeepsTicksInOrder(t *testing.T) {
+	for _, steps := range [][]string{
+		{"0.5", "-0.5"},
+		{"-0.5", "0.5", "0"},
+		{"0.5"},
+		{"0.3", "-0.2", "0.1", "-0.4"},
+	} {
+		g, err := ParseGroove("g", "8", steps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ppqn := range []int{4, 24, 96} {
+			prev := math.Inf(-1)
+			for i := 0; i < 8*ppqn; i++ {
+				beat := g.tickBeat(i, ppqn)
+				if beat < prev {
+					t.Fatalf("%s at %d PPQN: Tick %d on beat %g, before %g", g, ppqn, i, beat, prev)
+				}
+				prev = beat
+			}
+		}
+	}
+}
+
+func TestParseGroove(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		steps []string
+		want  string
+	}{
+		{"16", []string{"0", "0.1@-0.2", "0", "0.15@-0.1"}, "g: 16 0 0.1@-0.2 0 0.15@-0.1"},
+		{"4", []string{"-0.5@1"}, "g: 4 -0.5@1"},
+		{"3", []string{"0"}, ""},
+		{"16", nil, ""},
+		{"16", []string{"0.6"}, ""},
+		{"16", []string{"0@1.5"}, ""},
+		{"16", []string{"early"}, ""},
+	} {
+		g, err := ParseGroove("g", tc.value, tc.steps)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s %v: parsed %s", tc.value, tc.steps, g)
+			}
+			continue
+		}
+		if err != nil || g.String() != tc.want {
+			t.Errorf("%s %v: %v, %v, want %s", tc.value, tc.steps, g, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		percent float64
+		value   int
+	}{{49, 8}, {76, 8}, {60, 3}, {60, 64}} {
+		if _, err := SwingGroove(tc.percent, tc.value); err == nil {
+			t.Errorf("swing %g%% of %d: no error", tc.percent, tc.value)
+		}
+	}
+}
+
+func TestGrooveVelocity(t *testing.T) {
+	g, err := ParseGroove("g", "8", []string{"0@0.5", "0@-0.75"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		tick     int
+		played   float32
+		change   float32
+		velocity float32
+	}{
+		{0, 0.75, 0.5, 1.0}, // clamped
+		{11, 0.25, 0.5, 0.75},
+		{12, 0.5, -0.75, 0.0}, // clamped
+		{24, 0.5, 0.5, 1.0},
+	} {
+		v := g.velocity(tc.tick, 24)
+		ev := accent(Event{KeyDown, 1, PlayNote(NoteZero(), tc.played, 0, 0), 0}, v)
+		got := ev.Arg.(velocityNote).Velocity()
+		if v != tc.change || got != tc.velocity {
+			t.Errorf("Tick %d: %+g to %g, giving %g, want %+g to %g",
+				tc.tick, v, tc.played, got, tc.change, tc.velocity)
+		}
+	}
+}
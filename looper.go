@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	Rec     = "rec"
+	Overdub = "overdub"
+	Undo    = "undo"
+	Halve   = "halve"
+	Double  = "double"
+	Reverse = "reverse"
+	Play    = "play"
+	Stop    = "stop"
+	Clear   = "clear"
+	Beats   = "beats"
+)
+
+// A Looper is an Effect which records its input for some number of beats
+// of the Clock, and then plays it back in a loop, mixed with its input.
+// Further passes may be overdubbed on top, as layers, and removed again
+// in reverse order.
+//
+// Like a Synchronizer, the Looper quantizes its transport: Rec, Overdub,
+// Play and Stop Events take effect only on the next Tick on its grid.
+// Everything else takes effect immediately.
+type Looper struct {
+	simpleEffect
+	quantizer
+
+	beats   int      // length of a recording, in quarter notes
+	pending []string // transport Events, awaiting a Tick
+
+	recording   bool
+	started     float64 // the Clock's beat when recording began
+	playing     bool
+	overdubbing bool
+	dubbed      int // frames into the current overdub
+
+	layers  [][]float32 // each of length frames
+	length  int
+	pos     int
+	reverse bool
+}
+
+func NewLooper(name string) *Looper {
+	return &Looper{
+		simpleEffect: makeSimpleEffect(name),
+		quantizer:    makeQuantizer(),
+
+		beats:   4,
+		pending: []string{},
+		layers:  [][]float32{},
+	}
+}
+
+func NewLooperNode(name string) Node { return Node(NewLooper(name)) }
+
+func (e *Looper) String() string {
+	state := "stopped"
+	switch {
+	case e.recording:
+		state = "recording"
+	case e.overdubbing:
+		state = "overdubbing"
+	case e.playing:
+		state = "playing"
+	}
+	return fmt.Sprintf("[%s: %s, %d beats, %d layers, %s]", NodeLabel(e), state, e.beats, len(e.layers), e.quantizer)
+}
+
+func (e *Looper) Kind() string { return "Looper" }
+
+// subscriptions satisfies the busSubscriber interface for Looper.
+func (e *Looper) subscriptions() []string { return []string{Tick} }
+
+func (e *Looper) processEvent(ev Event) {
+	if e.quantizer.processEvent(ev) {
+		return
+	}
+
+	switch ev.Type {
+	case Tick:
+		e.tick(ev)
+
+	case Rec, Overdub, Play, Stop:
+		e.pending = append(e.pending, ev.Type)
+
+	case Undo:
+		if len(e.layers) <= 1 {
+			e.clear()
+			break
+		}
+		e.layers = e.layers[:len(e.layers)-1]
+		e.overdubbing = false
+
+	case Halve:
+		if e.recording || e.length < 2 {
+			break
+		}
+		e.resize(e.length / 2)
+
+	case Double:
+		if e.recording || e.length <= 0 {
+			break
+		}
+		e.resize(e.length * 2)
+
+	case Reverse:
+		e.reverse = !e.reverse
+
+	case Clear:
+		e.clear()
+
+	case Beats:
+		if n := int(ev.Value); n > 0 && n <= 64 {
+			e.beats = n
+		}
+
+	default:
+		e.simpleEffect.processEvent(ev)
+	}
+}
+
+// tick finishes a recording after the right number of beats, from the
+// Tick it began on, and applies pending transport Events on quantized
+// Ticks.
+func (e *Looper) tick(ev Event) {
+	if e.recording && tickBeat(ev) >= e.started+float64(e.beats)-1e-9 { // allowing for rounding
+		e.finishRecording(ev)
+	}
+
+	if !e.onGrid(ev) {
+		return
+	}
+	for _, action := range e.pending {
+		switch action {
+		case Rec:
+			e.clear()
+			e.recording = true
+			e.started = tickBeat(ev)
+			frames := e.loopFrames(ev)
+			e.layers = append(e.layers, make([]float32, 0, frames+config.BufferSize))
+
+		case Overdub:
+			if e.length <= 0 || e.recording {
+				break
+			}
+			e.layers = append(e.layers, make([]float32, e.length))
+			e.overdubbing = true
+			e.dubbed = 0
+			e.playing = true
+
+		case Play:
+			if e.length <= 0 || e.recording {
+				break
+			}
+			e.playing = true
+			e.pos = 0
+
+		case Stop:
+			if e.recording {
+				e.clear() // incomplete
+			}
+			e.playing = false
+			e.overdubbing = false
+		}
+	}
+	e.pending = e.pending[:0]
+}
+
+// finishRecording sets the loop length to exactly the frames the Clock
+// took over the recorded number of beats, so that the loop doesn't drift,
+// even if the tempo changed along the way. The layer's capacity is cut to
+// the length, so that the overrun isn't played if the loop is doubled.
+func (e *Looper) finishRecording(ev Event) {
+	e.recording = false
+	e.length = e.loopFrames(ev)
+	layer := e.layers[0]
+	for len(layer) < e.length {
+		layer = append(layer, 0.0)
+	}
+	e.layers[0] = layer[:e.length:e.length]
+	e.playing = true
+	e.pos = 0
+}
+
+// loopFrames returns the length of the recording, from the beat it began
+// on, as timed by the Clock of the Tick.
+func (e *Looper) loopFrames(ev Event) int {
+	if c, ok := ev.Arg.(*Clock); ok {
+		return int(c.Frame(e.started+float64(e.beats)) - c.Frame(e.started))
+	}
+	return e.beats * bpm2frames(120)
+}
+
+// tickBeat returns the Clock's beat on which the Tick falls.
+func tickBeat(ev Event) float64 {
+	if c, ok := ev.Arg.(*Clock); ok {
+		return float64(ev.Value) / float64(c.PPQN())
+	}
+	return 0
+}
+
+// resize changes the loop length of all layers. When shortening, the
+// excess is kept, in the layer's capacity, so that a subsequent lengthening
+// restores it. Otherwise, lengthening repeats the layer.
+func (e *Looper) resize(length int) {
+	for i, layer := range e.layers {
+		if cap(layer) >= length {
+			e.layers[i] = layer[:length]
+			continue
+		}
+		longer := make([]float32, length)
+		for j := 0; j < length; j += len(layer) {
+			copy(longer[j:], layer)
+		}
+		e.layers[i] = longer
+	}
+	e.length = length
+	e.pos = e.pos % length
+}
+
+func (e *Looper) clear() {
+	e.layers = e.layers[:0]
+	e.length, e.pos = 0, 0
+	e.recording, e.playing, e.overdubbing = false, false, false
+}
+
+// processAudio mixes the loop into the buffer, and records the buffer into
+// the loop, as appropriate.
+func (e *Looper) processAudio(buf []float32) {
+	for i, v := range buf {
+		if e.recording {
+			if len(e.layers[0]) < cap(e.layers[0]) {
+				e.layers[0] = append(e.layers[0], v)
+			}
+			continue
+		}
+		if !e.playing || e.length <= 0 {
+			continue
+		}
+
+		for _, layer := range e.layers {
+			buf[i] += layer[e.pos]
+		}
+		if e.overdubbing {
+			e.layers[len(e.layers)-1][e.pos] = v
+			if e.dubbed++; e.dubbed >= e.length {
+				e.overdubbing = false
+			}
+		}
+
+		if e.reverse {
+			e.pos = (e.pos + e.length - 1) % e.length
+		} else {
+			e.pos = (e.pos + 1) % e.length
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// testPatch returns a Field with a Mixer and a Clock, and more Nodes built
+// from the script, and its Engine.
+func testPatch(tb testing.TB, script string) (*Field, *Engine) {
+	f := NewField()
+	m := NewMixer()
+	f.Add(m)
+	f.Add(NewClock(f))
+	e := NewEngine(f, m)
+	o := &recordingOutput{}
+	NewFieldParser(f, e, o).Parse(script)
+	if o.err != nil {
+		tb.Fatal(o.err)
+	}
+	return f, e
+}
+
+// looperPatch records an AudioInput, whose frames are numbered, into a
+// Looper.
+type looperPatch struct {
+	f   *Field
+	e   *Engine
+	c   *Clock
+	lp  *Looper
+	in  []float32
+	out []float32
+}
+
+func newLooperPatch(t *testing.T, script string) *looperPatch {
+	f, e := testPatch(t, "add input i; add looper lp; i -> lp; lp -> mixer; "+script)
+	c, _ := f.Get("clock")
+	lp, _ := f.Get("lp")
+	return &looperPatch{
+		f:   f,
+		e:   e,
+		c:   c.(*Clock),
+		lp:  lp.(*Looper),
+		in:  make([]float32, config.BufferSize),
+		out: make([]float32, config.BufferSize),
+	}
+}
+
+// render renders a block, whose input is the number of each frame.
+func (p *looperPatch) render() {
+	now := p.f.Now()
+	for i := range p.in {
+		p.in[i] = float32(now + int64(i))
+	}
+	p.e.ProcessAudio(p.in, p.out)
+}
+
+// record records a loop, and returns the frame at which it began.
+func (p *looperPatch) record(t *testing.T) int64 {
+	p.e.Perform(p.lp, Event{Rec, 0, nil, 0})
+	p.render()
+	for i := 0; len(p.lp.pending) > 0 || p.lp.recording; i++ {
+		if i > 1000 {
+			t.Fatal("never finished recording")
+		}
+		p.render()
+	}
+	return p.c.Frame(p.lp.started)
+}
+
+func TestLooperRecordsOffTheBeat(t *testing.T) {
+	for _, tc := range []struct {
+		script  string
+		beats   int
+		offBeat bool // Rec may fall between beats
+	}{
+		{"beats-2 -> lp", 2, false},
+		{"beats-2 -> lp; quantize:16 -> lp", 2, true},
+		{"beats-3 -> lp; quantize:tick -> lp; mod-7 -> lp", 3, true},
+		{"beats-1 -> lp; quantize:8 -> lp; bpm-97 -> clock", 1, true},
+	} {
+		p := newLooperPatch(t, tc.script)
+		p.render()
+		start := p.record(t)
+		for i := 0; tc.offBeat && p.lp.started == math.Floor(p.lp.started); i++ {
+			if i > 20 {
+				t.Fatalf("%s: Rec never fell off the beat", tc.script)
+			}
+			p.render()
+			start = p.record(t)
+		}
+
+		want := int(p.c.Frame(p.lp.started+float64(tc.beats)) - start)
+		layer := p.lp.layers[0]
+		if p.lp.length != want || len(layer) != want {
+			t.Errorf("%s: length %d, %d frames; want %d", tc.script, p.lp.length, len(layer), want)
+			continue
+		}
+		for i, v := range layer {
+			if v != float32(start+int64(i)) {
+				t.Errorf("%s: from beat %g, frame %d is %g, want %d", tc.script, p.lp.started, i, v, start+int64(i))
+				break
+			}
+		}
+	}
+}
+
+func TestLooperResize(t *testing.T) {
+	// a loop shorter than a block, so that its overrun could fill it twice
+	saved := config
+	defer func() { config = saved }()
+	config.BufferSize = 16384
+	p := newLooperPatch(t, "beats-1 -> lp; bpm-300 -> clock")
+	p.render()
+	start := p.record(t)
+	length := p.lp.length
+
+	// frame checks that the loop's frame i is the input's frame j.
+	frame := func(how string, i, j int) {
+		if v := p.lp.layers[0][i]; v != float32(start+int64(j)) {
+			t.Fatalf("%s: frame %d is %g, want %d", how, i, v, start+int64(j))
+		}
+	}
+	resize := func(typ string, want int) {
+		p.e.Perform(p.lp, Event{typ, 0, nil, 0})
+		p.render()
+		if p.lp.length != want || len(p.lp.layers[0]) != want {
+			t.Fatalf("%s: length %d, want %d", typ, p.lp.length, want)
+		}
+	}
+
+	// doubling a fresh recording repeats it, rather than its overrun
+	resize(Double, 2*length)
+	for i := 0; i < 2*length; i++ {
+		frame("double", i, i%length)
+	}
+
+	// halving, then doubling, restores what was halved
+	resize(Halve, length)
+	resize(Halve, length/2)
+	resize(Double, length)
+	for i := 0; i < length; i++ {
+		frame("halve, double", i, i)
+	}
+}
@@ -2,24 +2,44 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 )
 
 var (
 	cmdfile = flag.String("cmdfile", "default.txt", "command file")
 	dotfile = flag.String("dotfile", "G.dot", "Field representation will be written here")
+	srate   = flag.Int("srate", 44100, "audio sample rate")
+	bufsz   = flag.Int("bufsz", 2048, "audio buffer size, in frames")
+
+	infile   = flag.String("infile", "", "render offline, with audio input from this WAV file")
+	outfile  = flag.String("outfile", "", "render offline, with audio output to this WAV file")
+	duration = flag.Duration("duration", 0, "render offline for this long (default: length of -infile)")
 )
 
-func init() {
+func main() {
 	flag.Parse()
-}
+	config = EngineConfig{
+		SampleRate: *srate,
+		BufferSize: *bufsz,
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(2)
+	}
 
-func main() {
 	o := StdOutput{}
 	f := NewField()
-	f.Add(NewMixer())
+	m := NewMixer()
+	f.Add(m)
 	f.Add(NewClock(f))
-	p := NewFieldParser(f, o)
+	e := NewEngine(f, m)
+	go e.ReportRejections(o)
+	offline := *infile != "" || *outfile != "" || *duration > 0
+	if !offline {
+		go e.Play()
+	}
+	p := NewFieldParser(f, e, o)
 
 	if fi, err := NewFileInput(*cmdfile); err == nil {
 		D("reading %s", *cmdfile)
@@ -29,6 +49,14 @@ func main() {
 		D("%s not read: %s", *cmdfile, err)
 	}
 
+	if offline {
+		if err := e.RenderWAV(*infile, *outfile, *duration); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	ii := &InteractiveInput{}
 	REPL(ii, p)
 }
@@ -43,7 +71,7 @@ func REPL(r Input, e Parser) {
 	} // L
 }
 
-func writeDotfile(f Field) {
+func writeDotfile(f *Field) {
 	if *dotfile == "" {
 		return
 	}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// peakHold is how long the highest recent peak is held by a meter.
+const peakHold = 1500 * time.Millisecond
+
+// A meter measures the level of a stream of audio blocks.
+type meter struct {
+	peak    float32 // of the last block
+	rms     float32 // of the last block
+	hold    float32 // highest peak within peakHold
+	holdAge int     // blocks since hold was set
+	clips   int     // samples outside [-1 .. 1]
+	blocks  int     // measured
+}
+
+// measure updates the meter with the next block.
+func (m *meter) measure(buf []float32) {
+	var peak float32 = 0.0
+	var sum float64 = 0.0
+	for _, v := range buf {
+		a := v
+		if a < 0 {
+			a = -a
+		}
+		if a > peak {
+			peak = a
+		}
+		if a > 1.0 {
+			m.clips++
+		}
+		sum += float64(v) * float64(v)
+	}
+	m.peak = peak
+	m.rms = 0.0
+	if len(buf) > 0 {
+		m.rms = float32(math.Sqrt(sum / float64(len(buf))))
+	}
+
+	m.blocks++
+	m.holdAge++
+	if peak >= m.hold || time.Duration(m.holdAge)*config.BlockDuration() > peakHold {
+		m.hold = peak
+		m.holdAge = 0
+	}
+}
+
+func (m *meter) String() string {
+	return fmt.Sprintf(
+		"peak %s  rms %s  hold %s  clips %d",
+		dB(m.peak),
+		dB(m.rms),
+		dB(m.hold),
+		m.clips,
+	)
+}
+
+// dB formats a linear amplitude as decibels relative to full scale.
+func dB(a float32) string {
+	if a <= 0.0 {
+		return "  -inf dB"
+	}
+	return fmt.Sprintf("%6.1f dB", 20*math.Log10(float64(a)))
+}
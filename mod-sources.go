@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+const (
+	Shape = "shape"
+	Steps = "steps"
+	Step  = "step"
+)
+
+// ShapeEvent sets the waveform of a ModLFO: sine, triangle, square or saw.
+// From the REPL, it may be written as eg. shape:square.
+func ShapeEvent(shape string) Event { return Event{Shape + ":" + shape, 0.0, nil, 0} }
+
+// StepEvent sets the value of step i of a ModStep.
+// From the REPL, it may be written as eg. step:3-0.5.
+func StepEvent(i int, v float32) Event { return Event{fmt.Sprintf("%s:%d", Step, i), v, nil, 0} }
+
+// A ModLFO is a modulation source which oscillates in [-1 .. 1] at hz.
+type ModLFO struct {
+	modSource
+
+	shape string
+	hz    float32
+	phase float32 // 0..1
+}
+
+func NewModLFO(name string) *ModLFO {
+	return &ModLFO{
+		modSource: makeModSource(name),
+
+		shape: "sine",
+		hz:    1.0,
+	}
+}
+
+func NewModLFONode(name string) Node { return Node(NewModLFO(name)) }
+
+func (s *ModLFO) String() string {
+	return fmt.Sprintf("[%s: %s @ %.2f hz, %s]", NodeLabel(s), s.shape, s.hz, s.modSource.String())
+}
+
+func (s *ModLFO) Kind() string { return "Modulation LFO" }
+
+func (s *ModLFO) processEvent(ev Event) {
+	if strings.HasPrefix(ev.Type, Shape+":") {
+		switch shape := strings.TrimPrefix(ev.Type, Shape+":"); shape {
+		case "sine", "triangle", "square", "saw":
+			s.shape = shape
+		default:
+			D("%s: invalid %s", s.Name(), ev.Type)
+		}
+		return
+	}
+
+	switch ev.Type {
+	case Hz:
+		if ev.Value >= 0.0 {
+			s.hz = ev.Value
+		}
+	default:
+		s.modSource.processEvent(ev)
+	}
+}
+
+// advance satisfies the clocked interface.
+func (s *ModLFO) advance(frames int) {
+	s.phase += s.hz * float32(frames) / float32(config.SampleRate)
+	s.phase -= float32(math.Floor(float64(s.phase)))
+
+	var v float32
+	switch s.shape {
+	case "triangle":
+		v = 1 - 4*float32(math.Abs(float64(s.phase-0.5)))
+	case "square":
+		v = 1
+		if s.phase >= 0.5 {
+			v = -1
+		}
+	case "saw":
+		v = 2*s.phase - 1
+	default:
+		v = float32(math.Sin(2 * math.Pi * float64(s.phase)))
+	}
+	s.send(v)
+}
+
+//
+//
+//
+
+// A ModEnvelope is a modulation source which follows an envelope, in
+// [0 .. 1], gated by KeyDown and KeyUp. It takes the same Events as an
+// ADSR.
+type ModEnvelope struct {
+	modSource
+	envelope
+}
+
+func NewModEnvelope(name string) *ModEnvelope {
+	return &ModEnvelope{
+		modSource: makeModSource(name),
+		envelope:  makeEnvelope(),
+	}
+}
+
+func NewModEnvelopeNode(name string) Node { return Node(NewModEnvelope(name)) }
+
+func (s *ModEnvelope) String() string {
+	return fmt.Sprintf("[%s: %s, %s]", NodeLabel(s), s.envelope.String(), s.modSource.String())
+}
+
+func (s *ModEnvelope) Kind() string { return "Modulation Envelope" }
+
+func (s *ModEnvelope) processEvent(ev Event) {
+	switch ev.Type {
+	case Route, Unsubscribe, Kill:
+		s.modSource.processEvent(ev)
+	default:
+		s.envelope.processEvent(ev)
+	}
+}
+
+// advance satisfies the clocked interface.
+func (s *ModEnvelope) advance(frames int) {
+	var v float32
+	for i := 0; i < frames; i++ {
+		v = s.envelope.next()
+	}
+	s.send(v)
+}
+
+//
+//
+//
+
+// A ModRandom is a modulation source which jumps to a new random value in
+// [-1 .. 1], hz times per second, and holds it in between.
+type ModRandom struct {
+	modSource
+
+	hz     float32
+	frames int // since the last jump
+}
+
+func NewModRandom(name string) *ModRandom {
+	s := &ModRandom{
+		modSource: makeModSource(name),
+		hz:        4.0,
+	}
+	s.value = 2*rand.Float32() - 1
+	return s
+}
+
+func NewModRandomNode(name string) Node { return Node(NewModRandom(name)) }
+
+func (s *ModRandom) String() string {
+	return fmt.Sprintf("[%s: %.2f hz, %s]", NodeLabel(s), s.hz, s.modSource.String())
+}
+
+func (s *ModRandom) Kind() string { return "Modulation Random" }
+
+func (s *ModRandom) processEvent(ev Event) {
+	switch ev.Type {
+	case Hz:
+		if ev.Value > 0.0 {
+			s.hz = ev.Value
+		}
+	default:
+		s.modSource.processEvent(ev)
+	}
+}
+
+// advance satisfies the clocked interface.
+func (s *ModRandom) advance(frames int) {
+	v := s.value
+	s.frames += frames
+	period := int(float32(config.SampleRate) / s.hz)
+	if period < 1 {
+		period = 1 // faster than the sample rate: a new value every block
+	}
+	if s.frames >= period {
+		s.frames %= period
+		v = 2*rand.Float32() - 1
+	}
+	s.send(v)
+}
+
+//
+//
+//
+
+// maxSteps is the most steps a ModStep can have.
+const maxSteps = 32
+
+// A ModStep is a modulation source which steps through a sequence of
+// values, in [0 .. 1], moving to the next on every Tick on its grid.
+type ModStep struct {
+	modSource
+	quantizer
+
+	steps [maxSteps]float32
+	n     int
+	i     int
+}
+
+func NewModStep(name string) *ModStep {
+	return &ModStep{
+		modSource: makeModSource(name),
+		quantizer: makeQuantizer(),
+		n:         8,
+	}
+}
+
+func NewModStepNode(name string) Node { return Node(NewModStep(name)) }
+
+func (s *ModStep) String() string {
+	return fmt.Sprintf("[%s: %d/%d, %s]", NodeLabel(s), s.i+1, s.n, s.modSource.String())
+}
+
+func (s *ModStep) Kind() string { return "Modulation Step" }
+
+// subscriptions satisfies the busSubscriber interface for ModStep.
+func (s *ModStep) subscriptions() []string { return []string{Tick} }
+
+func (s *ModStep) processEvent(ev Event) {
+	if strings.HasPrefix(ev.Type, Step+":") {
+		var i int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(ev.Type, Step+":"), "%d", &i); err != nil || i < 1 || i > maxSteps {
+			D("%s: invalid %s", s.Name(), ev.Type)
+			return
+		}
+		if ev.Value >= 0.0 && ev.Value <= 1.0 {
+			s.steps[i-1] = ev.Value // steps are numbered from 1
+		}
+		return
+	}
+
+	if s.quantizer.processEvent(ev) {
+		return
+	}
+
+	switch ev.Type {
+	case Tick:
+		if s.onGrid(ev) {
+			s.i = (s.i + 1) % s.n
+		}
+	case Steps:
+		if n := int(ev.Value); n >= 1 && n <= maxSteps {
+			s.n, s.i = n, s.i%n
+		}
+	default:
+		s.modSource.processEvent(ev)
+	}
+}
+
+// advance satisfies the clocked interface.
+func (s *ModStep) advance(frames int) {
+	s.send(s.steps[s.i])
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	Route    = "route"
+	Modulate = "modulate"
+)
+
+// A modRoute connects a modulation source to one parameter of a target
+// Node. It's owned by the source, and only ever changed by it, on the
+// audio path; its identity tells the target which offset to replace.
+type modRoute struct {
+	target  Node
+	param   string
+	depth   float32
+	removed bool
+}
+
+// RouteEvent asks a modulation source to modulate the parameter of the
+// target by depth. A depth of 0 removes the route.
+func RouteEvent(target Node, param string, depth float32) Event {
+	return Event{Route, depth, &modRoute{target: target, param: param}, 0}
+}
+
+// ModulateEvent sets the offset contributed by the route to its target's
+// parameter.
+func ModulateEvent(r *modRoute, offset float32) Event { return Event{Modulate, offset, r, 0} }
+
+// A modulatable Node's parameters may be the targets of modulation. It
+// returns the names of those parameters.
+type modulatable interface {
+	modulatable() []string
+}
+
+// A modulator is a modulation source, which can describe its routes. The
+// routes may only be read while holding the Field lock.
+type modulator interface {
+	modRoutes() []*modRoute
+}
+
+//
+//
+//
+
+// modulated may be embedded into any modulatable Node. It records the
+// offset contributed by each route to the Node's parameters. Offsets apply
+// on top of the values set by regular Events, which are left unchanged.
+type modulated struct {
+	routes  []*modRoute
+	offsets []float32
+}
+
+// modulate applies a Modulate Event.
+func (m *modulated) modulate(ev Event) {
+	r, ok := ev.Arg.(*modRoute)
+	if !ok {
+		D("modulated got Modulate Event without a route")
+		return
+	}
+	for i := range m.routes {
+		if m.routes[i] != r {
+			continue
+		}
+		if r.removed {
+			m.routes = append(m.routes[:i], m.routes[i+1:]...)
+			m.offsets = append(m.offsets[:i], m.offsets[i+1:]...)
+			return
+		}
+		m.offsets[i] = ev.Value
+		return
+	}
+	if !r.removed {
+		m.routes = append(m.routes, r)
+		m.offsets = append(m.offsets, ev.Value)
+	}
+}
+
+// offset returns the sum of the offsets of the parameter.
+func (m *modulated) offset(param string) float32 {
+	var sum float32 = 0.0
+	for i, r := range m.routes {
+		if r.param == param {
+			sum += m.offsets[i]
+		}
+	}
+	return sum
+}
+
+//
+//
+//
+
+// modSource is designed to be embedded into modulation sources. They're
+// control-rate Nodes, without audio: once per block, as they advance, they
+// compute a value, and send each route's target an offset of value × depth.
+// Targets see the offset from the start of the following block.
+type modSource struct {
+	nodeName
+	noParents
+	noChildren
+	mailbox
+
+	routes []*modRoute
+	value  float32
+}
+
+func makeModSource(name string) modSource {
+	return modSource{
+		nodeName: nodeName(name),
+		routes:   []*modRoute{},
+	}
+}
+
+// modRoutes satisfies the modulator interface.
+func (s *modSource) modRoutes() []*modRoute { return s.routes }
+
+// processEvent handles the Event types common to all modulation sources.
+// Concrete sources should pass any Events they don't handle themselves
+// down to it.
+func (s *modSource) processEvent(ev Event) {
+	switch ev.Type {
+	case Route:
+		r, ok := ev.Arg.(*modRoute)
+		if !ok {
+			D("%s: Route Event without a route", s.Name())
+			break
+		}
+		s.route(r.target, r.param, ev.Value)
+
+	case Unsubscribe: // the target has left the Field
+		n, ok := ev.Arg.(Node)
+		if !ok {
+			break
+		}
+		for i := 0; i < len(s.routes); {
+			if r := s.routes[i]; r.target.Name() == n.Name() {
+				s.route(r.target, r.param, 0.0) // removes it
+				continue
+			}
+			i++
+		}
+
+	case Kill:
+		for len(s.routes) > 0 {
+			s.route(s.routes[0].target, s.routes[0].param, 0.0)
+		}
+	}
+}
+
+// route adds, changes or (with a depth of 0) removes the route to the
+// target's parameter. A removed route's offset is cleared from its target.
+func (s *modSource) route(target Node, param string, depth float32) {
+	for i, r := range s.routes {
+		if r.target.Name() != target.Name() || r.param != param {
+			continue
+		}
+		if depth != 0.0 {
+			r.depth = depth
+			return
+		}
+		r.removed = true
+		r.target.Send(ModulateEvent(r, 0.0))
+		s.routes = append(s.routes[:i], s.routes[i+1:]...)
+		return
+	}
+	if depth != 0.0 {
+		s.routes = append(s.routes, &modRoute{target: target, param: param, depth: depth})
+	}
+}
+
+// send sends the value to every route.
+func (s *modSource) send(value float32) {
+	s.value = value
+	for _, r := range s.routes {
+		r.target.Send(ModulateEvent(r, value*r.depth))
+	}
+}
+
+func (s *modSource) String() string {
+	return fmt.Sprintf("%+.2f, %d routes", s.value, len(s.routes))
+}
+
+func clamp01(v float32) float32 {
+	if v < 0.0 {
+		return 0.0
+	} else if v > 1.0 {
+		return 1.0
+	}
+	return v
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A multiEffect is designed to be embedded into effects which accept one or
+// more input audio streams, combine them somehow, and provide the combined
+// output as exactly one output audio stream. It's the multipleParents
+// analogue of the simpleEffect. Every block, the Engine gives it exactly one
+// buffer from each of its inputs.
+type multiEffect struct {
+	nodeName
+	*multipleParents
+	singleChild
+	mailbox
+	audioOutput
+}
+
+func makeMultiEffect(name string) multiEffect {
+	return multiEffect{
+		nodeName:        nodeName(name),
+		multipleParents: newMultipleParents(),
+		audioOutput:     makeAudioOutput(),
+	}
+}
+
+// The multiAudioProcessor interface is designed to be implemented by
+// concrete multi-input effects. The processAudio method should combine the
+// input buffers into the passed out buffer, which is zeroed beforehand.
+// There is one input buffer per parent, in the order given by Parents();
+// the input of a parent which isn't an AudioSender is nil.
+type multiAudioProcessor interface {
+	processAudio(in [][]float32, out []float32)
+}
+
+// processEvent handles the Event types common to all multi-input effects.
+// Concrete effects should pass any Events they don't handle themselves
+// down to it.
+func (me *multiEffect) processEvent(ev Event) {
+	switch ev.Type {
+	case Connect, Disconnect:
+		me.singleChild.processEvent(ev, me)
+
+	case Connection: // upstream
+		if _, senderOk := ev.Arg.(AudioSender); !senderOk {
+			D("multiEffect got Connection from non-AudioSender")
+			break
+		}
+		node, nodeOk := ev.Arg.(Node)
+		if !nodeOk {
+			D("multiEffect got Connection from non-Node")
+			break
+		}
+		me.multipleParents.AddParent(node)
+
+	case Disconnection: // upstream
+		node, nodeOk := ev.Arg.(Node)
+		if !nodeOk {
+			break
+		}
+		me.multipleParents.DeleteParent(node.Name())
+
+	case Kill:
+		me.multipleParents = newMultipleParents()
+		me.ChildNode = nilNode
+	}
+}
+
+//
+//
+//
+
+// InputGainEvent sets the gain of a single named input of a Sum.
+// From the REPL, it may be written as eg. gain:a-0.5.
+func InputGainEvent(input string, g float32) Event {
+	return Event{Gain + ":" + input, g, nil, 0}
+}
+
+// A Sum is an Effect which adds together all of its inputs,
+// each scaled by its own gain.
+type Sum struct {
+	multiEffect
+
+	gains map[string]*smoothed // input name: gain; default 1.0
+}
+
+func NewSum(name string) *Sum {
+	e := &Sum{
+		multiEffect: makeMultiEffect(name),
+
+		gains: map[string]*smoothed{},
+	}
+	return e
+}
+
+func NewSumNode(name string) Node { return Node(NewSum(name)) }
+
+func (e *Sum) String() string {
+	return fmt.Sprintf("[%s: %d inputs]", NodeLabel(e), len(e.Parents()))
+}
+
+func (e *Sum) Kind() string { return "Sum" }
+
+// Sum's processEvent manages changes to per-input gain.
+func (e *Sum) processEvent(ev Event) {
+	if !strings.HasPrefix(ev.Type, Gain+":") {
+		e.multiEffect.processEvent(ev)
+		return
+	}
+	input := strings.TrimPrefix(ev.Type, Gain+":")
+	if input == "" || ev.Value < 0.0 {
+		return
+	}
+	g, ok := e.gains[input]
+	if !ok {
+		s := makeSmoothed(1.0)
+		g = &s
+		e.gains[input] = g
+	}
+	g.set(ev.Value)
+}
+
+func (e *Sum) processAudio(in [][]float32, out []float32) {
+	for i, parent := range e.multipleParents.nodes {
+		if i >= len(in) || in[i] == nil {
+			continue
+		}
+		g, ok := e.gains[parent.Name()]
+		if !ok {
+			for j := 0; j < len(out) && j < len(in[i]); j++ {
+				out[j] += in[i][j]
+			}
+			continue
+		}
+		for j := 0; j < len(out) && j < len(in[i]); j++ {
+			out[j] += g.next() * in[i][j]
+		}
+	}
+}
+
+//
+//
+//
+
+// A RingMod is an Effect which multiplies its inputs together,
+// sample by sample. Typically it has exactly two: a carrier and
+// a modulator. Any missing input makes the output silent.
+type RingMod struct {
+	multiEffect
+}
+
+func NewRingMod(name string) *RingMod {
+	e := &RingMod{
+		multiEffect: makeMultiEffect(name),
+	}
+	return e
+}
+
+func NewRingModNode(name string) Node { return Node(NewRingMod(name)) }
+
+func (e *RingMod) String() string {
+	return fmt.Sprintf("[%s: %d inputs]", NodeLabel(e), len(e.Parents()))
+}
+
+func (e *RingMod) Kind() string { return "Ring Modulator" }
+
+func (e *RingMod) processAudio(in [][]float32, out []float32) {
+	if len(in) <= 0 {
+		return // silence
+	}
+	for _, buf := range in {
+		if len(buf) < len(out) {
+			return // silence
+		}
+	}
+	for j := range out {
+		out[j] = 1.0
+		for _, buf := range in {
+			out[j] *= buf[j]
+		}
+	}
+}
+
+//
+//
+//
+
+const (
+	Mix = "mix"
+)
+
+// A Crossfade is an Effect which blends between its first and second
+// inputs (in order of connection). At mix=0 only the first input is
+// heard; at mix=1 only the second.
+type Crossfade struct {
+	multiEffect
+	modulated
+
+	mix   float32 // 0..1
+	mixIn smoothed
+}
+
+func NewCrossfade(name string) *Crossfade {
+	e := &Crossfade{
+		multiEffect: makeMultiEffect(name),
+
+		mix:   0.5,
+		mixIn: makeSmoothed(0.5),
+	}
+	return e
+}
+
+func NewCrossfadeNode(name string) Node { return Node(NewCrossfade(name)) }
+
+func (e *Crossfade) String() string {
+	return fmt.Sprintf("[%s: mix %.2f]", NodeLabel(e), e.mix)
+}
+
+func (e *Crossfade) Kind() string { return "Crossfade" }
+
+// Crossfade's processEvent manages changes to the mix parameter.
+func (e *Crossfade) processEvent(ev Event) {
+	switch ev.Type {
+	case Mix:
+		if ev.Value >= 0.0 && ev.Value <= 1.0 {
+			e.mix = ev.Value
+		}
+	case Modulate:
+		e.modulate(ev)
+	default:
+		e.multiEffect.processEvent(ev)
+	}
+}
+
+// modulatable satisfies the modulatable interface.
+func (e *Crossfade) modulatable() []string { return []string{Mix} }
+
+func (e *Crossfade) processAudio(in [][]float32, out []float32) {
+	e.mixIn.set(clamp01(e.mix + e.offset(Mix)))
+	a, b := len(in) > 0 && len(in[0]) >= len(out), len(in) > 1 && len(in[1]) >= len(out)
+	for j := range out {
+		mix := e.mixIn.next()
+		if a {
+			out[j] += (1 - mix) * in[0][j]
+		}
+		if b {
+			out[j] += mix * in[1][j]
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 )
 
@@ -19,7 +20,9 @@ type note struct {
 func (n note) String() string { return n.str }
 func (n note) Hz() float32    { return n.hz }
 
-func NoteZero() Note { return note{"Ø", 0.0} }
+var noteZero Note = note{"Ø", 0.0}
+
+func NoteZero() Note { return noteZero }
 
 func ParseNote(s string) (Note, error) {
 	ss := strings.ToLower(strings.TrimSpace(s))
@@ -65,8 +68,12 @@ func ParseNote(s string) (Note, error) {
 	}
 
 	octaveChar := ss[1]
-	if len(s) == 3 {
+	switch len(s) {
+	case 2:
+	case 3:
 		octaveChar = ss[2]
+	default:
+		return nil, fmt.Errorf("too long")
 	}
 	octave := 0
 	switch octaveChar {
@@ -97,7 +104,181 @@ func ParseNote(s string) (Note, error) {
 
 	// http://en.wikipedia.org/wiki/Note#Note_frequency_.28hertz.29
 	p := (12 * octave) + offset
-	hz := math.Pow(2, (float64(p)-69.0)/12.0) * 440.0
-	n := note{str, float32(hz)}
+	n := note{str, float32(noteHz(p))}
 	return n, nil
 }
+
+// noteHz returns the frequency of the note p semitones above C0. A5, at
+// 440 Hz, is 69, as in MIDI, though MIDI calls it A4.
+func noteHz(p int) float64 {
+	return math.Pow(2, (float64(p)-69.0)/12.0) * 440.0
+}
+
+// notes holds every MIDI note, so that NearestNote needn't allocate.
+var notes [128]Note
+
+// detectedNotes holds every MIDI note, detected at every whole number of
+// cents from it, so that DetectNote needn't allocate.
+var detectedNotes [len(notes)][101]detectedNote
+
+var noDetectedNote = detectedNote{noteZero, 0.0}
+
+func init() {
+	names := []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+	for p := range notes {
+		notes[p] = note{fmt.Sprintf("%s%d", names[p%12], p/12), float32(noteHz(p))}
+		for c := range detectedNotes[p] {
+			detectedNotes[p][c] = detectedNote{notes[p], float32(c - 50)}
+		}
+	}
+}
+
+// NearestNote returns the Note closest to the frequency, and how far the
+// frequency is from it, in cents.
+func NearestNote(hz float32) (Note, float32) {
+	if hz <= 0.0 {
+		return NoteZero(), 0.0
+	}
+	p := nearest(hz)
+	return notes[p], Cents(hz, notes[p])
+}
+
+// nearest returns the number of the note closest to the frequency, which
+// must be positive.
+func nearest(hz float32) int {
+	p := int(math.Floor(69.0 + 12.0*math.Log2(float64(hz)/440.0) + 0.5))
+	if p < 0 {
+		return 0
+	} else if p >= len(notes) {
+		return len(notes) - 1
+	}
+	return p
+}
+
+// Cents returns how far the frequency is from the Note, in cents.
+func Cents(hz float32, n Note) float32 {
+	if hz <= 0.0 || n.Hz() <= 0.0 {
+		return 0.0
+	}
+	return float32(1200.0 * math.Log2(float64(hz)/float64(n.Hz())))
+}
+
+//
+//
+//
+
+// A velocityNote is a Note which was played with a velocity in [0 .. 1].
+type velocityNote interface {
+	Velocity() float32
+}
+
+// An expressiveNote is a Note which was played with per-note expression:
+// pitch bend, in semitones, and pressure, in [0 .. 1]. Both may change
+// while the Note is held, via Bend and Pressure Events.
+type expressiveNote interface {
+	velocityNote
+	Bend() float32
+	Pressure() float32
+}
+
+// A detectedNote is the Note closest to a detected frequency, with how far
+// the frequency is from it, to the nearest cent.
+type detectedNote struct {
+	Note
+	cents float32
+}
+
+// DetectNote returns the Note closest to the frequency, which also tells
+// how far the frequency is from it, via Cents. A frequency of 0 has
+// NoteZero, 0 cents from it.
+func DetectNote(hz float32) Note {
+	if hz <= 0.0 {
+		return &noDetectedNote
+	}
+	p := nearest(hz)
+	c := int(math.Floor(float64(Cents(hz, notes[p])) + 0.5))
+	if c < -50 {
+		c = -50
+	} else if c > 50 {
+		c = 50
+	}
+	return &detectedNotes[p][c+50]
+}
+
+func (n *detectedNote) Cents() float32 { return n.cents }
+
+func (n *detectedNote) String() string {
+	return fmt.Sprintf("%s%+.0fc", n.Note, n.cents)
+}
+
+// A playedNote is a Note with the expression it was played with. Its Hz is
+// the Note's own; bend is applied by whatever plays it.
+type playedNote struct {
+	Note
+	velocity float32
+	bend     float32
+	pressure float32
+}
+
+// PlayNote returns the Note, played with the velocity, pitch bend and
+// pressure.
+func PlayNote(n Note, velocity, bend, pressure float32) Note {
+	return playedNote{n, velocity, bend, pressure}
+}
+
+func (n playedNote) Velocity() float32 { return n.velocity }
+func (n playedNote) Bend() float32     { return n.bend }
+func (n playedNote) Pressure() float32 { return n.pressure }
+
+func (n playedNote) String() string {
+	s := fmt.Sprintf("%s@%.2f", n.Note, n.velocity)
+	if n.bend != 0.0 {
+		s += fmt.Sprintf(",bend=%+.2f", n.bend)
+	}
+	if n.pressure != 0.0 {
+		s += fmt.Sprintf(",pressure=%.2f", n.pressure)
+	}
+	return s
+}
+
+// ParsePlayedNote parses a Note with optional expression, which has the
+// grammar
+// PlayedNote := <note> [ "@" <velocity> { "," <param> "=" <float32> } ]
+// where param is bend (or b), in semitones, or pressure (or p). Without
+// any, it's a plain Note.
+func ParsePlayedNote(s string) (Note, error) {
+	toks := strings.SplitN(s, "@", 2)
+	n, err := ParseNote(toks[0])
+	if err != nil || len(toks) == 1 {
+		return n, err
+	}
+
+	params := strings.Split(toks[1], ",")
+	velocity, err := strconv.ParseFloat(params[0], 32)
+	if err != nil || velocity < 0.0 || velocity > 1.0 {
+		return nil, fmt.Errorf("velocity isn't in [0 .. 1]")
+	}
+	var bend, pressure float64
+	for _, param := range params[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s: expected <param>=<value>", param)
+		}
+		v, err := strconv.ParseFloat(kv[1], 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad value", param)
+		}
+		switch kv[0] {
+		case "bend", "b":
+			bend = v
+		case "pressure", "p":
+			if v < 0.0 || v > 1.0 {
+				return nil, fmt.Errorf("pressure isn't in [0 .. 1]")
+			}
+			pressure = v
+		default:
+			return nil, fmt.Errorf("%s: unknown parameter", kv[0])
+		}
+	}
+	return PlayNote(n, float32(velocity), float32(bend), float32(pressure)), nil
+}
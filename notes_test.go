@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseNote(t *testing.T) {
+	for _, tc := range []struct {
+		s   string
+		str string
+		hz  float64
+	}{
+		{"a4", "A4", 220.0},
+		{"a5", "A5", 440.0},
+		{"A5", "A5", 440.0},
+		{"c4", "C4", 130.81},
+		{"c#4", "C#4", 138.59},
+		{"db4", "Db4", 138.59},
+		{"c0", "C0", 8.18},
+		{"g9", "G9", 6271.93},
+	} {
+		n, err := ParseNote(tc.s)
+		if err != nil {
+			t.Errorf("%s: %s", tc.s, err)
+			continue
+		}
+		if n.String() != tc.str || math.Abs(float64(n.Hz())-tc.hz) > 0.01 {
+			t.Errorf("%s: %s at %.2f Hz, want %s at %.2f Hz", tc.s, n, n.Hz(), tc.str, tc.hz)
+		}
+	}
+	for _, s := range []string{"", "a", "h4", "a#", "ax"} {
+		if n, err := ParseNote(s); err == nil {
+			t.Errorf("%q: parsed as %s", s, n)
+		}
+	}
+}
+
+func TestNearestNote(t *testing.T) {
+	for _, tc := range []struct {
+		hz    float32
+		str   string
+		cents float32
+	}{
+		{440.0, "A5", 0},
+		{220.0, "A4", 0},
+		{445.0, "A5", 19.56},
+		{430.0, "A5", -39.80},
+		{452.9, "A#5", -49.97},
+		{261.63, "C5", 0},
+		{0.0, "Ø", 0},
+	} {
+		n, cents := NearestNote(tc.hz)
+		if n.String() != tc.str || math.Abs(float64(cents-tc.cents)) > 0.05 {
+			t.Errorf("%.2f Hz: %s %+.2f cents, want %s %+.2f cents", tc.hz, n, cents, tc.str, tc.cents)
+		}
+	}
+
+	// the names agree with ParseNote
+	for _, s := range []string{"c2", "f#3", "a4", "a5", "b7"} {
+		p, _ := ParseNote(s)
+		if n, _ := NearestNote(p.Hz()); n.String() != p.String() {
+			t.Errorf("%s is %.2f Hz, nearest %s", p, p.Hz(), n)
+		}
+	}
+}
@@ -22,3 +22,27 @@ func (o StdOutput) Print(s string) {
 func (o StdOutput) Printf(format string, args ...interface{}) {
 	fmt.Printf(format+"\n", args...)
 }
+
+//
+//
+//
+
+// A bufferedOutput holds the lines written to it, until they're flushed to
+// another Output.
+type bufferedOutput struct{ lines []string }
+
+func (o *bufferedOutput) Print(s string) {
+	o.lines = append(o.lines, s)
+}
+
+func (o *bufferedOutput) Printf(format string, args ...interface{}) {
+	o.lines = append(o.lines, fmt.Sprintf(format, args...))
+}
+
+// flush writes every line held to the Output, and forgets them.
+func (o *bufferedOutput) flush(to Output) {
+	for _, s := range o.lines {
+		to.Print(s)
+	}
+	o.lines = nil
+}
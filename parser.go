@@ -1,7 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -29,14 +34,24 @@ func (p EchoParser) Parse(s string) {
 //
 
 type FieldParser struct {
-	f      Field
+	f      *Field
+	e      *Engine
 	output Output
+
+	recordings map[string]*recorder // Node name: recorder
+	scopes     map[string]*scope    // Node name: scope
+	grooves    map[string]*Groove   // defined by name
 }
 
-func NewFieldParser(f Field, output Output) *FieldParser {
+func NewFieldParser(f *Field, e *Engine, output Output) *FieldParser {
 	return &FieldParser{
 		f:      f,
+		e:      e,
 		output: output,
+
+		recordings: map[string]*recorder{},
+		scopes:     map[string]*scope{},
+		grooves:    map[string]*Groove{},
 	}
 }
 
@@ -48,12 +63,18 @@ func (f *FieldParser) Parse(s string) {
 }
 
 func (f *FieldParser) parse(s string) {
-	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimSpace(s)
 	if s == "" {
 		return
 	}
 
 	toks := strings.Split(s, " ")
+	path := pathToken(toks)
+	for i := range toks {
+		if i != path {
+			toks[i] = strings.ToLower(toks[i])
+		}
+	}
 	cmd, args := toks[0], toks[1:]
 	switch cmd {
 
@@ -63,6 +84,66 @@ func (f *FieldParser) parse(s string) {
 	case "sleep":
 		f.parseSleep(args)
 
+	case "stats":
+		f.parseStats(args)
+
+	case "meter", "meters":
+		f.parseMeter(args)
+
+	case "record":
+		f.parseRecord(args)
+
+	case "events":
+		f.parseEvents(args)
+
+	case "watch":
+		f.parseWatch(args)
+
+	case "unwatch":
+		f.parseUnwatch(args)
+
+	case "bus":
+		f.parseBus(args)
+
+	case "queue":
+		f.parseQueue(args)
+
+	case "position", "pos":
+		f.parsePosition()
+
+	case "timesig":
+		f.parseTimeSig(args)
+
+	case "ppqn":
+		f.parsePPQN(args)
+
+	case "bpm":
+		f.parseBPM(args)
+
+	case "tempo":
+		f.parseTempo(args)
+
+	case "swing":
+		f.parseSwing(args)
+
+	case "groove":
+		f.parseGroove(args)
+
+	case "spectrum":
+		f.parseSpectrum(args)
+
+	case "tune":
+		f.parseTune(args)
+
+	case "scope":
+		f.parseScope(args)
+
+	case "mod":
+		f.parseMod(args)
+
+	case "smooth", "smoothing":
+		f.parseSmooth(args)
+
 	case "add":
 		f.parseAdd(args)
 
@@ -74,6 +155,23 @@ func (f *FieldParser) parse(s string) {
 	}
 }
 
+// pathToken returns the index of the file path among the tokens of the
+// command, or -1 if it doesn't take one. Everything else is lowercased, but
+// the path is taken as written.
+func pathToken(toks []string) int {
+	if len(toks) < 2 {
+		return -1
+	}
+	switch cmd, sub := strings.ToLower(toks[0]), strings.ToLower(toks[1]); {
+	case cmd == "record" && sub == "start":
+		return 3
+	case cmd == "events" && (sub == "record" || sub == "replay"),
+		cmd == "tempo" && (sub == "save" || sub == "load"):
+		return 2
+	}
+	return -1
+}
+
 func (f *FieldParser) parseInfo() {
 	f.output.Printf("\n%s\n", f.f.Dot())
 }
@@ -91,6 +189,483 @@ func (f *FieldParser) parseSleep(args []string) {
 	time.Sleep(d)
 }
 
+func (f *FieldParser) parseStats(args []string) {
+	if len(args) >= 1 && args[0] == "reset" {
+		f.e.ResetStats()
+		f.output.Print("stats reset: OK")
+		return
+	}
+	f.e.ReportStats(f.output)
+}
+
+func (f *FieldParser) parseMeter(args []string) {
+	if len(args) < 1 {
+		f.e.ReportMeters(f.output)
+		return
+	}
+	switch args[0] {
+	case "on":
+		f.e.SetMetering(true)
+	case "off":
+		f.e.SetMetering(false)
+	case "reset":
+		f.e.ResetMeters()
+	default:
+		f.output.Print("usage: meter [on|off|reset]")
+		return
+	}
+	f.output.Printf("meter %s: OK", args[0])
+}
+
+func (f *FieldParser) parseRecord(args []string) {
+	for name, r := range f.recordings {
+		if r.closed() {
+			f.stopRecording(name, r) // its Node was killed
+		}
+	}
+	if len(args) < 1 {
+		for name, r := range f.recordings {
+			f.output.Printf("%s -> %s", name, r)
+		}
+		return
+	}
+
+	switch args[0] {
+	case "start":
+		if len(args) < 3 {
+			f.output.Print("usage: record start <node> <file.wav>")
+			return
+		}
+		name, path := args[1], args[2]
+		if _, ok := f.recordings[name]; ok {
+			f.output.Printf("record start %s: already recording", name)
+			return
+		}
+		r, err := newRecorder(path)
+		if err != nil {
+			f.output.Printf("record start %s %s: %s", name, path, err)
+			return
+		}
+		if err := f.e.Tap(name, r); err != nil {
+			r.close()
+			r.wait()
+			os.Remove(path)
+			f.output.Printf("record start %s %s: %s", name, path, err)
+			return
+		}
+		f.recordings[name] = r
+		f.output.Printf("record start %s %s: OK", name, path)
+
+	case "stop":
+		names := args[1:]
+		if len(names) <= 0 {
+			for name := range f.recordings {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			r, ok := f.recordings[name]
+			if !ok {
+				f.output.Printf("record stop %s: not recording", name)
+				continue
+			}
+			f.stopRecording(name, r)
+		}
+
+	default:
+		f.output.Print("usage: record [start <node> <file.wav> | stop [node]]")
+	}
+}
+
+// stopRecording detaches the recorder from the named Node, and forgets it,
+// once its file has been finished.
+func (f *FieldParser) stopRecording(name string, r *recorder) {
+	f.e.Untap(name, r)
+	delete(f.recordings, name)
+	if err := r.wait(); err != nil {
+		f.output.Printf("record stop %s: %s", name, err)
+		return
+	}
+	f.output.Printf("record stop %s: %s: OK", name, r)
+}
+
+func (f *FieldParser) parseEvents(args []string) {
+	if len(args) < 1 {
+		if s, ok := f.e.RecordingEvents(); ok {
+			f.output.Printf("events: recording %s", s)
+		} else {
+			f.output.Print("events: not recording")
+		}
+		return
+	}
+
+	switch args[0] {
+	case "record":
+		if len(args) < 2 {
+			f.output.Print("usage: events record <file>")
+			return
+		}
+		if err := f.e.RecordEvents(args[1]); err != nil {
+			f.output.Printf("events record %s: %s", args[1], err)
+			return
+		}
+		f.output.Printf("events record %s: OK", args[1])
+
+	case "stop":
+		s, err := f.e.StopRecordingEvents()
+		if err != nil {
+			f.output.Printf("events stop: %s", err)
+			return
+		}
+		f.output.Printf("events stop: %s", s)
+
+	case "replay":
+		if len(args) < 2 {
+			f.output.Print("usage: events replay <file>")
+			return
+		}
+		n, err := f.e.ReplayEvents(args[1])
+		if err != nil {
+			f.output.Printf("events replay %s: %s", args[1], err)
+			return
+		}
+		f.output.Printf("events replay %s: %d Events OK", args[1], n)
+
+	default:
+		f.output.Print("usage: events [record <file> | stop | replay <file>]")
+	}
+}
+
+func (f *FieldParser) parseWatch(args []string) {
+	if len(args) < 1 {
+		for _, s := range f.f.Watchers() {
+			f.output.Print(s)
+		}
+		return
+	}
+	if len(args) != 2 {
+		f.output.Print("usage: watch <node|*> <type|*>")
+		return
+	}
+	w, err := f.f.Watch(args[0], args[1])
+	if err != nil {
+		f.output.Printf("watch %s %s: %s", args[0], args[1], err)
+		return
+	}
+	go w.report(f.output)
+	f.output.Printf("watch %s %s: OK, watch %d", args[0], args[1], w.id)
+}
+
+func (f *FieldParser) parseUnwatch(args []string) {
+	if len(args) != 1 {
+		f.output.Print("usage: unwatch <id|all>")
+		return
+	}
+	id := 0
+	if args[0] != "all" {
+		i, err := strconv.Atoi(args[0])
+		if err != nil || i <= 0 {
+			f.output.Printf("unwatch %s: invalid id", args[0])
+			return
+		}
+		id = i
+	}
+	if err := f.f.Unwatch(id); err != nil {
+		f.output.Printf("unwatch %s: %s", args[0], err)
+		return
+	}
+	f.output.Printf("unwatch %s: OK", args[0])
+}
+
+func (f *FieldParser) parseBus(args []string) {
+	if len(args) < 1 {
+		subs := f.f.Subscriptions()
+		types := make([]string, 0, len(subs))
+		for typ := range subs {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+		for _, typ := range types {
+			f.output.Printf("%s: %s", typ, strings.Join(subs[typ], ", "))
+		}
+		followers := f.f.Followers()
+		pubs := make([]string, 0, len(followers))
+		for pub := range followers {
+			pubs = append(pubs, pub)
+		}
+		sort.Strings(pubs)
+		for _, pub := range pubs {
+			f.output.Printf("%s => *: %s", pub, strings.Join(followers[pub], ", "))
+		}
+		return
+	}
+	if len(args) != 3 || (args[0] != "subscribe" && args[0] != "unsubscribe") {
+		f.output.Print("usage: bus [subscribe|unsubscribe <node> <type>]")
+		return
+	}
+	var err error
+	if args[0] == "subscribe" {
+		err = f.f.Subscribe(args[1], args[2])
+	} else {
+		err = f.f.Unsubscribe(args[1], args[2])
+	}
+	if err != nil {
+		f.output.Printf("bus %s %s %s: %s", args[0], args[1], args[2], err)
+		return
+	}
+	f.output.Printf("bus %s %s %s: OK", args[0], args[1], args[2])
+}
+
+func (f *FieldParser) parseQueue(args []string) {
+	if len(args) < 1 || len(args) > 3 {
+		f.output.Print("usage: queue <node> [<policy> [<size>]]")
+		return
+	}
+	node, err := f.f.Get(args[0])
+	if err != nil {
+		f.output.Printf("queue %s: %s", args[0], err)
+		return
+	}
+	q, ok := node.(queued)
+	if !ok {
+		f.output.Printf("queue %s: doesn't queue Events", args[0])
+		return
+	}
+	if len(args) == 1 {
+		p, size, dropped := q.queue()
+		f.output.Printf("queue %s: %s, size %d, %d dropped", args[0], p, size, dropped)
+		return
+	}
+
+	p, err := parseQueuePolicy(args[1])
+	if err != nil {
+		f.output.Printf("queue %s: %s (try: drop-oldest, drop-newest, coalesce, block)", args[0], err)
+		return
+	}
+	size := 0
+	if len(args) == 3 {
+		if size, err = strconv.Atoi(args[2]); err != nil || size < 1 {
+			f.output.Printf("queue %s: invalid size %s", args[0], args[2])
+			return
+		}
+	}
+	q.setQueue(p, size)
+	f.output.Printf("queue %s %s: OK", args[0], strings.Join(args[1:], " "))
+}
+
+func (f *FieldParser) parseSpectrum(args []string) {
+	if len(args) < 1 {
+		f.output.Print("usage: spectrum <analyzer> [json]")
+		return
+	}
+	n, err := f.f.Get(args[0])
+	if err != nil {
+		f.output.Printf("spectrum %s: %s", args[0], err)
+		return
+	}
+	a, ok := n.(*Analyzer)
+	if !ok {
+		f.output.Printf("spectrum %s: not an Analyzer", args[0])
+		return
+	}
+	s := a.Spectrum()
+	if len(args) >= 2 && args[1] == "json" {
+		buf, err := json.Marshal(s)
+		if err != nil {
+			f.output.Printf("spectrum %s: %s", args[0], err)
+			return
+		}
+		f.output.Print(string(buf))
+		return
+	}
+	s.report(f.output)
+}
+
+func (f *FieldParser) parseTune(args []string) {
+	if len(args) < 1 {
+		f.output.Print("usage: tune <tuner>")
+		return
+	}
+	n, err := f.f.Get(args[0])
+	if err != nil {
+		f.output.Printf("tune %s: %s", args[0], err)
+		return
+	}
+	t, ok := n.(*Tuner)
+	if !ok {
+		f.output.Printf("tune %s: not a Tuner", args[0])
+		return
+	}
+	f.output.Printf("%s: %s", t.Name(), tunerReadout(t.Pitch()))
+}
+
+func (f *FieldParser) parseScope(args []string) {
+	const usage = "usage: scope [<node> [level <l>|off] [time <zoom>] [amp <zoom>] | stop [node]]"
+	for name, s := range f.scopes {
+		if s.closed() {
+			delete(f.scopes, name) // its Node was killed
+		}
+	}
+	if len(args) < 1 {
+		names := make([]string, 0, len(f.scopes))
+		for name := range f.scopes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f.output.Printf("scope %s: %s", name, f.scopes[name])
+		}
+		return
+	}
+	if args[0] == "stop" {
+		names := args[1:]
+		if len(names) <= 0 {
+			for name := range f.scopes {
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			s, ok := f.scopes[name]
+			if !ok {
+				f.output.Printf("scope stop %s: not scoping", name)
+				continue
+			}
+			f.e.Untap(name, s)
+			delete(f.scopes, name)
+			f.output.Printf("scope stop %s: OK", name)
+		}
+		return
+	}
+
+	name, v := args[0], defaultScopeView()
+	for opts := args[1:]; len(opts) > 0; opts = opts[2:] {
+		if len(opts) < 2 {
+			f.output.Print(usage)
+			return
+		}
+		if opts[0] == "level" && opts[1] == "off" {
+			v.triggered = false
+			continue
+		}
+		val, err := strconv.ParseFloat(opts[1], 32)
+		if err != nil {
+			f.output.Printf("scope %s: %s: bad value %s", name, opts[0], opts[1])
+			return
+		}
+		switch opts[0] {
+		case "level":
+			v.level = float32(val)
+		case "time":
+			v.time = float32(val)
+		case "amp":
+			v.amp = float32(val)
+		default:
+			f.output.Print(usage)
+			return
+		}
+	}
+	if v.time <= 0.0 || v.amp <= 0.0 {
+		f.output.Printf("scope %s: zoom must be positive", name)
+		return
+	}
+
+	s := newScope(v)
+	if err := f.e.Tap(name, s); err != nil {
+		f.output.Printf("scope %s: %s", name, err)
+		return
+	}
+	if old, ok := f.scopes[name]; ok {
+		f.e.Untap(name, old)
+	}
+	f.scopes[name] = s
+	go s.report(f.output, name)
+	f.output.Printf("scope %s: OK, %s", name, v)
+}
+
+func (f *FieldParser) parseMod(args []string) {
+	if len(args) < 3 {
+		f.output.Print("usage: mod <source> <target>.<param> <depth>")
+		return
+	}
+	src, err := f.f.Get(args[0])
+	if err != nil {
+		f.output.Printf("mod %s: %s", args[0], err)
+		return
+	}
+	if _, ok := src.(modulator); !ok {
+		f.output.Printf("mod %s: not a modulation source", args[0])
+		return
+	}
+
+	toks := strings.SplitN(args[1], ".", 2)
+	if len(toks) != 2 {
+		f.output.Print("usage: mod <source> <target>.<param> <depth>")
+		return
+	}
+	tgt, err := f.f.Get(toks[0])
+	if err != nil {
+		f.output.Printf("mod %s %s: %s", args[0], args[1], err)
+		return
+	}
+	m, ok := tgt.(modulatable)
+	if !ok {
+		f.output.Printf("mod %s %s: %s can't be modulated", args[0], args[1], toks[0])
+		return
+	}
+	params, param := m.modulatable(), toks[1]
+	found := false
+	for _, p := range params {
+		found = found || p == param
+	}
+	if !found {
+		f.output.Printf(
+			"mod %s %s: %s has no parameter %s (try: %s)",
+			args[0],
+			args[1],
+			toks[0],
+			param,
+			strings.Join(params, ", "),
+		)
+		return
+	}
+
+	depth, err := strconv.ParseFloat(args[2], 32)
+	if err != nil {
+		f.output.Printf("mod %s %s: bad depth %s", args[0], args[1], args[2])
+		return
+	}
+	f.e.Perform(src, RouteEvent(tgt, param, float32(depth)))
+	f.output.Printf("mod %s %s %.2f: OK", args[0], args[1], depth)
+}
+
+func (f *FieldParser) parseSmooth(args []string) {
+	d, m := Smoothing()
+	if len(args) >= 1 {
+		if args[0] == "off" {
+			d = 0
+		} else if parsed, err := time.ParseDuration(args[0]); err == nil && parsed >= 0 {
+			d = parsed
+		} else {
+			f.output.Print("usage: smooth [<duration>|off] [ramp|onepole]")
+			return
+		}
+	}
+	if len(args) >= 2 {
+		mode, err := parseSmoothingMode(args[1])
+		if err != nil {
+			f.output.Printf("smooth: %s", err)
+			return
+		}
+		m = mode
+	}
+	SetSmoothing(d, m)
+	if d == 0 {
+		f.output.Print("smooth: off")
+		return
+	}
+	f.output.Printf("smooth: %s %s", d, m)
+}
+
 func (f *FieldParser) parseAdd(args []string) {
 	if len(args) < 2 {
 		f.output.Print("usage: add <kind> <name>")
@@ -126,6 +701,9 @@ func (f *FieldParser) parseDelete(args []string) {
 		f.output.Printf("%s", err)
 		return
 	}
+	if r, ok := f.recordings[args[0]]; ok {
+		f.stopRecording(args[0], r)
+	}
 }
 
 func (f *FieldParser) parseArbitrary(cmd string, args []string) {
@@ -167,47 +745,460 @@ func (f *FieldParser) entity(s string) (interface{}, error) {
 		return node, nil
 	}
 
-	note, err := ParseNote(s)
+	note, err := ParsePlayedNote(s)
 	if err == nil {
 		return KeyDownEvent(note), nil
 	}
+	if strings.Contains(s, "@") {
+		return nil, err
+	}
 
 	switch s {
 	case KeyUp, "ø", "Ø", "0":
 		return KeyUpEvent(NoteZero()), nil
 	}
 
-	// TODO it's not clear to me that I want to allow this.
-	// TODO perhaps better to explicitly parse all Event types?
 	ev, err := ParseArbitraryEvent(s)
-	if err == nil {
-		D("parsed arbitrary Event %v", ev)
-		return ev, nil
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized")
 	}
-
-	return nil, fmt.Errorf("unrecognized")
+	if _, _, err := LookupEvent(ev.Type); err != nil {
+		return nil, fmt.Errorf("unrecognized: not a Node, Note or Event type")
+	}
+	if err := ValidateEvent(ev); err != nil {
+		return nil, err
+	}
+	D("parsed arbitrary Event %v", ev)
+	return ev, nil
 }
 
 func (f *FieldParser) parseEventCmd(ev Event, cmd string, args []string) {
 	switch cmd {
 	case "->", "=>":
-		if len(args) < 1 {
-			f.output.Printf("usage: %s -> <target>", ev)
+		if len(args) != 1 && (len(args) != 3 || args[1] != "at") {
+			f.output.Printf("usage: %s -> <target> [at <time>]", ev)
 			return
 		}
+		if len(args) == 3 {
+			at, err := f.parseTime(args[2])
+			if err != nil {
+				f.output.Printf("%s -> %s at %s: %s", ev, args[0], args[2], err)
+				return
+			}
+			ev = ev.Timed(at)
+		}
 		tgt := args[0]
 		node, err := f.f.Get(tgt)
 		if err != nil {
 			f.output.Printf("%s -> %s: target: %s", ev, tgt, err)
+			return
 		}
-		node.Events() <- ev
-		f.output.Printf("[%s %.1f] -> %s: OK", ev.Type, ev.Value, node.Name())
+		if err := acceptEvent(node, ev); err != nil {
+			f.output.Printf("%s -> %s: %s", ev, NodeLabel(node), err)
+			return
+		}
+		f.e.Perform(node, ev)
+		f.output.Printf("%s -> %s: OK", ev, node.Name())
 
 	default:
 		f.output.Printf("unknown command '%s'", cmd)
 	}
 }
 
+// parseTime parses a frame of the Field's timeline. It may be written as a
+// frame number; as a quarter note on the Clock's grid, eg. 16b or 16.5b;
+// as a Position, eg. 5:1 or 5:3:12; or relative to now, as a duration, eg.
+// +250ms, or in quarter notes, eg. +2b.
+func (f *FieldParser) parseTime(s string) (int64, error) {
+	now := f.f.Now()
+	relative := strings.HasPrefix(s, "+")
+	s = strings.TrimPrefix(s, "+")
+
+	if strings.Contains(s, ":") && !relative {
+		p, err := ParsePosition(s)
+		if err != nil {
+			return 0, err
+		}
+		c, err := f.clock()
+		if err != nil {
+			return 0, err
+		}
+		return c.Frame(c.PositionBeat(p)), nil
+	}
+
+	if strings.HasSuffix(s, "b") {
+		beats, err := strconv.ParseFloat(strings.TrimSuffix(s, "b"), 64)
+		if err != nil || beats < 0 {
+			return 0, fmt.Errorf("invalid beats")
+		}
+		c, err := f.clock()
+		if err != nil {
+			return 0, err
+		}
+		if relative {
+			beats += c.Beat(now)
+		}
+		return c.Frame(beats), nil
+	}
+
+	if relative {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("invalid duration")
+		}
+		return now + int64(d.Seconds()*float64(config.SampleRate)), nil
+	}
+
+	frame, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || frame < 0 {
+		return 0, fmt.Errorf("invalid frame")
+	}
+	return frame, nil
+}
+
+// clock returns the Field's Clock.
+func (f *FieldParser) clock() (*Clock, error) {
+	n, err := f.f.Get("clock")
+	if err != nil {
+		return nil, fmt.Errorf("no clock")
+	}
+	c, ok := n.(*Clock)
+	if !ok {
+		return nil, fmt.Errorf("no clock")
+	}
+	return c, nil
+}
+
+func (f *FieldParser) parsePosition() {
+	c, err := f.clock()
+	if err != nil {
+		f.output.Printf("position: %s", err)
+		return
+	}
+	now := f.f.Now()
+	f.output.Printf(
+		"position %s (beat %.2f, %s, %d PPQN, %.2f BPM)",
+		c.Position(now),
+		c.Beat(now),
+		c.TimeSignature(),
+		c.PPQN(),
+		c.BPM(),
+	)
+}
+
+func (f *FieldParser) parseTimeSig(args []string) {
+	c, err := f.clock()
+	if err != nil {
+		f.output.Printf("timesig: %s", err)
+		return
+	}
+	if len(args) < 1 {
+		f.output.Printf("timesig %s", c.TimeSignature())
+		return
+	}
+	sig, err := ParseTimeSignature(args[0])
+	if err != nil {
+		f.output.Printf("timesig %s: %s", args[0], err)
+		return
+	}
+	if noteTicks(sig.Den, c.PPQN()) <= 0 {
+		f.output.Printf("timesig %s: %d PPQN can't count it", sig, c.PPQN())
+		return
+	}
+	f.e.Perform(c, TimeSigEvent(sig))
+	f.output.Printf("timesig %s: OK, from the next bar", sig)
+}
+
+func (f *FieldParser) parsePPQN(args []string) {
+	c, err := f.clock()
+	if err != nil {
+		f.output.Printf("ppqn: %s", err)
+		return
+	}
+	if len(args) < 1 {
+		f.output.Printf("ppqn %d", c.PPQN())
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > maxPPQN {
+		f.output.Printf("ppqn %s: not a count from 1 to %d", args[0], maxPPQN)
+		return
+	}
+	if sig := c.TimeSignature(); noteTicks(sig.Den, n) <= 0 {
+		f.output.Printf("ppqn %d: can't count %s", n, sig)
+		return
+	}
+	f.e.Perform(c, Event{PPQN, float32(n), nil, 0})
+	f.output.Printf("ppqn %d: OK", n)
+}
+
+func (f *FieldParser) parseBPM(args []string) {
+	c, err := f.clock()
+	if err != nil {
+		f.output.Printf("bpm: %s", err)
+		return
+	}
+	if len(args) < 1 {
+		f.output.Printf("bpm %.2f", c.BPM())
+		return
+	}
+	bpm, err := strconv.ParseFloat(args[0], 32)
+	if err != nil || bpm <= 0 {
+		f.output.Printf("bpm %s: not a tempo", args[0])
+		return
+	}
+	if len(args) < 3 || args[1] != "ramp" {
+		if len(args) > 1 {
+			f.output.Print("usage: bpm [<bpm> [ramp <n>bars|<n>beats]]")
+			return
+		}
+		f.e.Perform(c, Event{BPM, float32(bpm), nil, 0})
+		f.output.Printf("bpm %g: OK", bpm)
+		return
+	}
+	l, err := ParseRampLength(args[2])
+	if err != nil {
+		f.output.Printf("bpm %g: %s", bpm, err)
+		return
+	}
+	f.e.Perform(c, RampEvent(float32(bpm), l))
+	f.output.Printf("bpm %g ramp %s: OK", bpm, l)
+}
+
+// parseTempo edits the Clock's tempo map. "tempo save" writes it as
+// "tempo at" commands, which a command file can include with the rest of
+// its patch, or "tempo load" can read back.
+func (f *FieldParser) parseTempo(args []string) {
+	c, err := f.clock()
+	if err != nil {
+		f.output.Printf("tempo: %s", err)
+		return
+	}
+	if len(args) < 1 {
+		for _, t := range c.TempoMap() {
+			f.output.Printf("tempo at %s (%s)", t, c.BeatPosition(t.Beat))
+		}
+		return
+	}
+
+	switch args[0] {
+	case "at":
+		if len(args) < 3 {
+			f.output.Print("usage: tempo at <bar>:<beat>[:<tick>]|<beat> <bpm> [ramp <n>bars|<n>beats]")
+			return
+		}
+		t, err := f.parseTempoChange(c, args[1:])
+		if err == nil {
+			err = c.SetTempoAt(t)
+		}
+		if err != nil {
+			f.output.Printf("tempo at %s: %s", args[1], err)
+			return
+		}
+		f.output.Printf("tempo at %s: OK", args[1])
+
+	case "clear":
+		c.ClearTempoMap()
+		f.output.Printf("tempo clear: OK, holding %.2f BPM", c.BPM())
+
+	case "save":
+		if len(args) < 2 {
+			f.output.Print("usage: tempo save <file>")
+			return
+		}
+		if err := writeTempoMap(args[1], c.TempoMap()); err != nil {
+			f.output.Printf("tempo save %s: %s", args[1], err)
+			return
+		}
+		f.output.Printf("tempo save %s: OK", args[1])
+
+	case "load":
+		if len(args) < 2 {
+			f.output.Print("usage: tempo load <file>")
+			return
+		}
+		changes, err := f.readTempoMap(c, args[1])
+		if err != nil {
+			f.output.Printf("tempo load %s: %s", args[1], err)
+			return
+		}
+		passed := c.LoadTempoMap(changes)
+		f.output.Printf("tempo load %s: OK, %d changes, %d passed and skipped", args[1], len(changes), passed)
+
+	default:
+		f.output.Print("usage: tempo [at <position> <bpm> [ramp <length>] | clear | save <file> | load <file>]")
+	}
+}
+
+// parseTempoChange parses the arguments of "tempo at": a position, a BPM,
+// and optionally, ramp and its length.
+func (f *FieldParser) parseTempoChange(c *Clock, args []string) (TempoChange, error) {
+	if len(args) != 2 && (len(args) != 4 || args[2] != "ramp") {
+		return TempoChange{}, fmt.Errorf("expected <position> <bpm> [ramp <length>]")
+	}
+	beat, err := f.parseBeat(c, args[0])
+	if err != nil {
+		return TempoChange{}, err
+	}
+	bpm, err := strconv.ParseFloat(args[1], 32)
+	if err != nil || bpm <= 0 {
+		return TempoChange{}, fmt.Errorf("%s isn't a tempo", args[1])
+	}
+	t := TempoChange{Beat: beat, BPM: float32(bpm)}
+	if len(args) == 4 {
+		l, err := ParseRampLength(args[3])
+		if err != nil {
+			return TempoChange{}, err
+		}
+		t.Ramp = c.RampBeats(beat, l)
+	}
+	return t, nil
+}
+
+// readTempoMap reads a tempo map written by "tempo save", in order.
+func (f *FieldParser) readTempoMap(c *Clock, path string) ([]TempoChange, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	changes := []TempoChange{}
+	for i, line := range strings.Split(string(buf), "\n") {
+		toks := strings.Fields(line)
+		if len(toks) < 2 || toks[0] != "tempo" || toks[1] != "at" {
+			continue
+		}
+		t, err := f.parseTempoChange(c, toks[2:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		if n := len(changes); n > 0 && t.Beat < changes[n-1].Beat {
+			return nil, fmt.Errorf("line %d: out of order", i+1)
+		}
+		changes = append(changes, t)
+	}
+	return changes, nil
+}
+
+// parseBeat parses a position on the Clock's grid, as a Position, or in
+// quarter notes.
+func (f *FieldParser) parseBeat(c *Clock, s string) (float64, error) {
+	if strings.Contains(s, ":") {
+		p, err := ParsePosition(s)
+		if err != nil {
+			return 0, err
+		}
+		return c.PositionBeat(p), nil
+	}
+	beat, err := strconv.ParseFloat(s, 64)
+	if err != nil || beat < 0 {
+		return 0, fmt.Errorf("invalid beat %s", s)
+	}
+	return beat, nil
+}
+
+// writeTempoMap writes the tempo map to the file, as "tempo at" commands.
+func writeTempoMap(path string, tempos []TempoChange) error {
+	lines := make([]string, len(tempos))
+	for i, t := range tempos {
+		lines[i] = "tempo at " + t.String() + "\n"
+	}
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0644)
+}
+
+func (f *FieldParser) parseSwing(args []string) {
+	if len(args) < 1 {
+		f.output.Printf("usage: swing <percent>|off [<note value>]")
+		return
+	}
+	c, err := f.clock()
+	if err != nil {
+		f.output.Printf("swing: %s", err)
+		return
+	}
+	if args[0] == "off" {
+		c.SetGroove(nil)
+		f.output.Printf("swing off: OK")
+		return
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(args[0], "%"), 64)
+	if err != nil {
+		f.output.Printf("swing %s: not a percentage", args[0])
+		return
+	}
+	value := 8
+	if len(args) >= 2 {
+		if value, err = strconv.Atoi(args[1]); err != nil {
+			f.output.Printf("swing %s: not a note value", args[1])
+			return
+		}
+	}
+	g, err := SwingGroove(percent, value)
+	if err != nil {
+		f.output.Printf("swing: %s", err)
+		return
+	}
+	f.setGroove(c, g)
+}
+
+func (f *FieldParser) parseGroove(args []string) {
+	c, err := f.clock()
+	if err != nil {
+		f.output.Printf("groove: %s", err)
+		return
+	}
+	if len(args) < 1 {
+		if g := c.Groove(); g != nil {
+			f.output.Printf("groove %s", g)
+		} else {
+			f.output.Printf("groove off")
+		}
+		names := []string{}
+		for name := range f.grooves {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f.output.Printf("  %s", f.grooves[name])
+		}
+		return
+	}
+	switch args[0] {
+	case "off":
+		c.SetGroove(nil)
+		f.output.Printf("groove off: OK")
+	case "define":
+		if len(args) < 4 {
+			f.output.Printf("usage: groove define <name> <note value> <timing>[@<velocity>]...")
+			return
+		}
+		g, err := ParseGroove(args[1], args[2], args[3:])
+		if err != nil {
+			f.output.Printf("groove %s: %s", args[1], err)
+			return
+		}
+		f.grooves[g.Name] = g
+		f.output.Printf("groove %s: defined", g)
+	default:
+		g, ok := f.grooves[args[0]]
+		if !ok {
+			f.output.Printf("groove %s: not defined", args[0])
+			return
+		}
+		f.setGroove(c, g)
+	}
+}
+
+// setGroove makes the Clock play the Groove, if its steps can be counted in
+// Ticks.
+func (f *FieldParser) setGroove(c *Clock, g *Groove) {
+	if noteTicks(g.Value, c.PPQN()) <= 0 {
+		f.output.Printf("groove %s: %d PPQN can't count it", g.Name, c.PPQN())
+		return
+	}
+	c.SetGroove(g)
+	f.output.Printf("groove %s: OK", g)
+}
+
 func (f *FieldParser) parseNodeCmd(node Node, cmd string, args []string) {
 	switch cmd {
 	case "=>", "->", "c", "connect":
@@ -237,5 +1228,25 @@ func (f *FieldParser) parseNodeCmd(node Node, cmd string, args []string) {
 			}
 			f.output.Printf("%s ≠> *: disconnect OK", node.Name())
 		}
+
+	case "subscribe", "unsubscribe":
+		if len(args) < 1 {
+			f.output.Printf("usage: %s %s <subscriber>", node.Name(), cmd)
+			return
+		}
+		var err error
+		if cmd == "subscribe" {
+			err = f.f.Follow(node.Name(), args[0])
+		} else {
+			err = f.f.Unfollow(node.Name(), args[0])
+		}
+		if err != nil {
+			f.output.Printf("%s %s %s: %s", node.Name(), cmd, args[0], err)
+			return
+		}
+		f.output.Printf("%s %s %s: OK", node.Name(), cmd, args[0])
+
+	default:
+		f.output.Printf("unknown command '%s'", cmd)
 	}
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A tap observes the output of a Node every block, without affecting it or
+// its downstream consumers. Taps are attached to Nodes via the Engine.
+//
+// observe is called on the audio path, once per block, after the Node has
+// rendered; it must never block or allocate, and must not keep the buffer.
+// close may be called from any goroutine, and also must never block. After
+// close, observe may still be called (briefly), but should have no effect.
+type tap interface {
+	observe(buf []float32)
+	close()
+}
+
+//
+//
+//
+
+// A recorder is a tap which writes the output of a Node to a WAV file.
+// Buffers are copied into a fixed pool, and passed to a background writer
+// goroutine. If the writer falls behind and the pool is exhausted, blocks
+// are dropped rather than blocking the audio path.
+type recorder struct {
+	dropped int64 // atomic
+	frames  int64 // written; atomic
+
+	path   string
+	blocks chan []float32 // filled; to the writer
+	free   chan []float32 // empty; from the writer
+	stop   chan struct{}
+	once   sync.Once
+	done   chan error
+}
+
+// recordPool is how much audio a recorder can buffer for its writer.
+const recordPool = 2 * time.Second
+
+func newRecorder(path string) (*recorder, error) {
+	w, err := createWAV(path, config.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	n := int(recordPool/config.BlockDuration()) + 1
+	r := &recorder{
+		path:   path,
+		blocks: make(chan []float32, n),
+		free:   make(chan []float32, n),
+		stop:   make(chan struct{}),
+		done:   make(chan error, 1),
+	}
+	for i := 0; i < n; i++ {
+		r.free <- make([]float32, config.BufferSize)
+	}
+	go r.write(w)
+	return r, nil
+}
+
+// observe satisfies the tap interface.
+func (r *recorder) observe(buf []float32) {
+	select {
+	case b := <-r.free:
+		copy(b, buf)
+		r.blocks <- b // never blocks: there are only as many buffers as slots
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+	}
+}
+
+// close satisfies the tap interface. The file is finished asynchronously;
+// call wait to find out how that went.
+func (r *recorder) close() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+// closed returns true once the recorder has been closed, eg. by the Engine,
+// when its Node was killed.
+func (r *recorder) closed() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait blocks until the file has been finished.
+func (r *recorder) wait() error {
+	err := <-r.done
+	r.done <- err // for subsequent callers
+	return err
+}
+
+func (r *recorder) String() string {
+	return fmt.Sprintf(
+		"%s: %.2fs, %d blocks dropped",
+		r.path,
+		float64(atomic.LoadInt64(&r.frames))/float64(config.SampleRate),
+		atomic.LoadInt64(&r.dropped),
+	)
+}
+
+func (r *recorder) write(w *wavWriter) {
+	var err error
+	writeOne := func(b []float32) {
+		if err == nil {
+			if err = w.write(b); err == nil {
+				atomic.AddInt64(&r.frames, int64(len(b)))
+			}
+		}
+		r.free <- b
+	}
+	for running := true; running; {
+		select {
+		case b := <-r.blocks:
+			writeOne(b)
+		case <-r.stop:
+			running = false
+		}
+	}
+	for drained := false; !drained; {
+		select {
+		case b := <-r.blocks:
+			writeOne(b)
+		default:
+			drained = true
+		}
+	}
+	if closeErr := w.close(); err == nil {
+		err = closeErr
+	}
+	r.done <- err
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A scope is a tap which repeatedly captures a few consecutive blocks of a
+// Node's output, to be drawn as a waveform, until it's closed. Like a
+// recorder, it copies into a fixed pool of buffers, so it never blocks or
+// allocates on the audio path.
+type scope struct {
+	view   scopeView
+	free   chan []float32
+	blocks chan []float32
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// scopeBlocks is how many consecutive blocks a scope captures: enough to
+// find a trigger within the first, and still draw a whole block after it.
+const scopeBlocks = 2
+
+// scopeRefresh is how often a scope is drawn, at most.
+const scopeRefresh = 500 * time.Millisecond
+
+func newScope(v scopeView) *scope {
+	s := &scope{
+		view:   v,
+		free:   make(chan []float32, scopeBlocks),
+		blocks: make(chan []float32, scopeBlocks),
+		stop:   make(chan struct{}),
+	}
+	for i := 0; i < scopeBlocks; i++ {
+		s.free <- make([]float32, config.BufferSize)
+	}
+	return s
+}
+
+// observe satisfies the tap interface.
+func (s *scope) observe(buf []float32) {
+	select {
+	case b := <-s.free:
+		copy(b, buf)
+		s.blocks <- b // never blocks
+	default:
+	}
+}
+
+// close satisfies the tap interface. It stops the scope being drawn.
+func (s *scope) close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// closed returns true once the scope has been closed, eg. by the Engine,
+// when its Node was killed.
+func (s *scope) closed() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *scope) String() string { return s.view.String() }
+
+// report draws the named Node's output to the Output, at most once per
+// scopeRefresh, until the scope is closed. It should be called on a
+// separate goroutine.
+//
+// The buffers are only returned to the pool once they've all been drawn,
+// so that the audio path fills them with consecutive blocks.
+func (s *scope) report(o Output, name string) {
+	taken := make([][]float32, 0, scopeBlocks)
+	frames := make([]float32, 0, scopeBlocks*config.BufferSize)
+	for {
+		taken, frames = taken[:0], frames[:0]
+		for len(taken) < scopeBlocks {
+			select {
+			case b := <-s.blocks:
+				taken = append(taken, b)
+				frames = append(frames, b...)
+			case <-s.stop:
+				return
+			}
+		}
+		s.view.draw(o, name, frames)
+		select {
+		case <-time.After(scopeRefresh):
+		case <-s.stop:
+			return
+		}
+		for _, b := range taken {
+			s.free <- b
+		}
+	}
+}
+
+//
+//
+//
+
+// A scopeView describes how captured frames are drawn.
+type scopeView struct {
+	triggered bool
+	level     float32 // trigger on a rising edge through this level
+	time      float32 // zoom: 1 draws one block across the width
+	amp       float32 // zoom: 1 draws [-1 .. 1] across the height
+}
+
+func defaultScopeView() scopeView {
+	return scopeView{
+		triggered: true,
+		level:     0.0,
+		time:      1.0,
+		amp:       1.0,
+	}
+}
+
+func (v scopeView) String() string {
+	level := "level off"
+	if v.triggered {
+		level = fmt.Sprintf("level %+.2f", v.level)
+	}
+	return fmt.Sprintf("%s, time %g, amp %g", level, v.time, v.amp)
+}
+
+const (
+	scopeWidth  = 72 // columns
+	scopeHeight = 15 // rows; odd, so there's a row for 0
+)
+
+// draw writes the frames to the Output as a waveform. Each column shows
+// the range of the frames it covers.
+func (v scopeView) draw(o Output, name string, frames []float32) {
+	window := int(float32(config.BufferSize) / v.time)
+	if window > len(frames)/2 {
+		window = len(frames) / 2
+	}
+
+	start, status := 0, "free-running"
+	if v.triggered {
+		status = fmt.Sprintf("untriggered at %+.2f", v.level)
+		for i := 1; i <= len(frames)-window; i++ {
+			if frames[i-1] < v.level && frames[i] >= v.level {
+				start, status = i, fmt.Sprintf("triggered at %+.2f", v.level)
+				break
+			}
+		}
+	}
+	frames = frames[start : start+window]
+
+	// row of a value, with row 0 at the top
+	row := func(x float32) int {
+		r := int(math.Floor(float64((1-x*v.amp)/2*(scopeHeight-1)) + 0.5))
+		if r < 0 {
+			return 0
+		} else if r >= scopeHeight {
+			return scopeHeight - 1
+		}
+		return r
+	}
+
+	grid := make([][]rune, scopeHeight)
+	for r := range grid {
+		fill := ' '
+		if r == scopeHeight/2 {
+			fill = '┄'
+		}
+		grid[r] = []rune(strings.Repeat(string(fill), scopeWidth))
+	}
+	for c := 0; c < scopeWidth; c++ {
+		span := frames[c*window/scopeWidth : (c+1)*window/scopeWidth]
+		if len(span) <= 0 {
+			continue // zoomed in further than a frame per column
+		}
+		lo, hi := span[0], span[0]
+		for _, x := range span {
+			if x < lo {
+				lo = x
+			}
+			if x > hi {
+				hi = x
+			}
+		}
+		top, bottom := row(hi), row(lo)
+		for r := top; r <= bottom; r++ {
+			grid[r][c] = '│'
+		}
+		if top == bottom {
+			grid[top][c] = '─'
+		}
+	}
+
+	o.Printf(
+		"scope %s: %.1f ms, ±%.2f, %s",
+		name,
+		float64(window)/float64(config.SampleRate)*1000,
+		1/v.amp,
+		status,
+	)
+	for r, line := range grid {
+		label := "      "
+		switch r {
+		case 0:
+			label = fmt.Sprintf("%+6.2f", 1/v.amp)
+		case scopeHeight / 2:
+			label = "  0.00"
+		case scopeHeight - 1:
+			label = fmt.Sprintf("%+6.2f", -1/v.amp)
+		}
+		marker := ' '
+		if v.triggered && r == row(v.level) {
+			marker = '▸'
+		}
+		o.Printf("%s %c%s", label, marker, string(line))
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// A smoothingMode is the shape of a smoothed parameter's move from one
+// value to the next.
+type smoothingMode int64
+
+const (
+	smoothRamp    smoothingMode = iota // linear, taking exactly the smoothing time
+	smoothOnePole                      // exponential, to within 1% in the smoothing time
+)
+
+func (m smoothingMode) String() string {
+	if m == smoothOnePole {
+		return "onepole"
+	}
+	return "ramp"
+}
+
+// parseSmoothingMode returns the smoothingMode named s.
+func parseSmoothingMode(s string) (smoothingMode, error) {
+	switch s {
+	case "ramp", "linear":
+		return smoothRamp, nil
+	case "onepole", "one-pole", "exp":
+		return smoothOnePole, nil
+	}
+	return smoothRamp, fmt.Errorf("invalid smoothing mode %s", s)
+}
+
+const (
+	onePoleResidue = 0.01 // of the change, left after the smoothing time
+	smoothEpsilon  = 1e-6 // close enough to the target to stop
+)
+
+// paramSmoothing is the smoothing applied to every parameter changed by an
+// Event. It's set from the REPL and read on the audio path, so its fields
+// are only ever accessed atomically.
+var paramSmoothing = struct {
+	d    int64 // time.Duration
+	mode int64 // smoothingMode
+}{
+	d:    int64(20 * time.Millisecond),
+	mode: int64(smoothRamp),
+}
+
+// SetSmoothing changes the smoothing of parameters in all Nodes. It takes
+// effect from their next change. A duration of 0 disables smoothing.
+func SetSmoothing(d time.Duration, m smoothingMode) {
+	atomic.StoreInt64(&paramSmoothing.d, int64(d))
+	atomic.StoreInt64(&paramSmoothing.mode, int64(m))
+}
+
+// Smoothing returns the smoothing of parameters in all Nodes.
+func Smoothing() (time.Duration, smoothingMode) {
+	d := atomic.LoadInt64(&paramSmoothing.d)
+	m := atomic.LoadInt64(&paramSmoothing.mode)
+	return time.Duration(d), smoothingMode(m)
+}
+
+//
+//
+//
+
+// A smoothed parameter moves to each new value gradually, frame by frame,
+// rather than jumping at a block boundary, so that changes made by Events
+// don't click. Nodes keep the value set by Events as they always have, and
+// use a smoothed for the value in effect.
+type smoothed struct {
+	value   float32 // in effect
+	target  float32
+	step    float32 // per frame: the increment of a ramp, or the one-pole coefficient
+	frames  int     // left in a ramp
+	onePole bool
+}
+
+func makeSmoothed(v float32) smoothed {
+	return smoothed{value: v, target: v}
+}
+
+// set moves towards v with the smoothing of all Nodes.
+func (s *smoothed) set(v float32) {
+	d, m := Smoothing()
+	s.glide(v, d, m)
+}
+
+// jump moves to v immediately.
+func (s *smoothed) jump(v float32) {
+	*s = makeSmoothed(v)
+}
+
+// glide moves towards v over the duration d. Setting the current target
+// again leaves a move in progress as it is.
+func (s *smoothed) glide(v float32, d time.Duration, m smoothingMode) {
+	if v == s.target {
+		return
+	}
+	frames := int(d.Seconds() * float64(config.SampleRate))
+	if frames <= 0 {
+		s.jump(v)
+		return
+	}
+	s.target = v
+	switch m {
+	case smoothOnePole:
+		s.onePole, s.frames = true, 0
+		s.step = float32(math.Pow(onePoleResidue, 1/float64(frames)))
+	default:
+		s.onePole, s.frames = false, frames
+		s.step = (v - s.value) / float32(frames)
+	}
+}
+
+// next returns the value in effect for the next frame.
+func (s *smoothed) next() float32 {
+	switch {
+	case s.value == s.target:
+	case s.onePole:
+		v := s.target + s.step*(s.value-s.target)
+		if d := v - s.target; v == s.value || (d < smoothEpsilon && d > -smoothEpsilon) {
+			v = s.target // close enough, or too close for float32 to move
+		}
+		s.value = v
+	default:
+		s.value += s.step
+		if s.frames--; s.frames <= 0 {
+			s.value = s.target
+		}
+	}
+	return s.value
+}
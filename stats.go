@@ -0,0 +1,167 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// histogramBuckets are the upper bounds of each bucket in a histogram,
+// as a percentage of the reference duration. There's one more bucket,
+// for everything above the last bound.
+var histogramBuckets = [...]int{25, 50, 75, 100, 150, 200}
+
+// A histogram counts durations relative to some reference duration,
+// typically the duration of one block.
+type histogram struct {
+	counts [len(histogramBuckets) + 1]int
+}
+
+func (h *histogram) add(d, ref time.Duration) {
+	pct := int(100 * d / ref)
+	i := 0
+	for i < len(histogramBuckets) && pct >= histogramBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+}
+
+func (h *histogram) report(o Output, title string) {
+	o.Printf("%s (%% of block):", title)
+	for i, n := range h.counts {
+		if i < len(histogramBuckets) {
+			o.Printf("  < %3d%%  %d", histogramBuckets[i], n)
+		} else {
+			o.Printf("  ≥ %3d%%  %d", histogramBuckets[i-1], n)
+		}
+	}
+}
+
+//
+//
+//
+
+// nodeStats are kept by the Engine for every Node it renders.
+type nodeStats struct {
+	blocks int
+	total  time.Duration // spent rendering
+	xruns  int           // blocks where this Node missed the deadline
+	meter  meter         // of its output, when metering is on
+}
+
+// engineStats are kept by the Engine to detect and report xruns. An xrun is
+// any block which isn't rendered before its deadline, ie. in less time than
+// it takes to play. The Engine counts an xrun against the Node which was
+// rendering when the deadline passed, and outputs silence for that block.
+//
+// Separately, a callback which arrives more than a block later than the
+// previous one suggests the audio subsystem itself dropped data; those are
+// counted as late callbacks.
+type engineStats struct {
+	sync.Mutex
+	blocks   int
+	xruns    int
+	late     int
+	last     time.Time // of the previous callback
+	render   histogram // time to render a block
+	interval histogram // time between callbacks
+	nodes    map[string]*nodeStats
+	master   meter // of the sink, always
+	metering bool  // of every AudioSender
+}
+
+func newEngineStats() *engineStats {
+	return &engineStats{
+		nodes: map[string]*nodeStats{},
+	}
+}
+
+// node returns the stats for the named Node, creating them if necessary.
+func (s *engineStats) node(name string) *nodeStats {
+	s.Lock()
+	defer s.Unlock()
+	ns, ok := s.nodes[name]
+	if !ok {
+		ns = &nodeStats{}
+		s.nodes[name] = ns
+	}
+	return ns
+}
+
+func (s *engineStats) reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.blocks, s.xruns, s.late = 0, 0, 0
+	s.render, s.interval = histogram{}, histogram{}
+	for _, ns := range s.nodes {
+		ns.blocks, ns.total, ns.xruns = 0, 0, 0
+	}
+}
+
+func (s *engineStats) resetMeters() {
+	s.Lock()
+	defer s.Unlock()
+	s.master = meter{}
+	for _, ns := range s.nodes {
+		ns.meter = meter{}
+	}
+}
+
+// reportMeters writes the meters to the Output. Like report, it prints
+// only after releasing the lock.
+func (s *engineStats) reportMeters(o Output) {
+	var b bufferedOutput
+	s.formatMeters(&b)
+	b.flush(o)
+}
+
+func (s *engineStats) formatMeters(o Output) {
+	s.Lock()
+	defer s.Unlock()
+	o.Printf("%-16s %s", "master", &s.master)
+	if !s.metering {
+		return
+	}
+	names := []string{}
+	for name := range s.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if m := &s.nodes[name].meter; m.blocks > 0 {
+			o.Printf("%-16s %s", name, m)
+		}
+	}
+}
+
+// report writes the stats to the Output. They're formatted under the lock,
+// and printed after it's released, so that a slow Output can't hold up
+// record on the audio path.
+func (s *engineStats) report(o Output) {
+	var b bufferedOutput
+	s.format(&b)
+	b.flush(o)
+}
+
+func (s *engineStats) format(o Output) {
+	s.Lock()
+	defer s.Unlock()
+	o.Printf("blocks %d, xruns %d, late callbacks %d", s.blocks, s.xruns, s.late)
+	s.render.report(o, "render time")
+	s.interval.report(o, "callback interval")
+
+	names := []string{}
+	for name := range s.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	o.Printf("%-16s %10s %6s", "node", "µs/block", "xruns")
+	for _, name := range names {
+		ns := s.nodes[name]
+		us := 0.0
+		if ns.blocks > 0 {
+			us = float64(ns.total/time.Microsecond) / float64(ns.blocks)
+		}
+		o.Printf("%-16s %10.1f %6d", name, us, ns.xruns)
+	}
+}
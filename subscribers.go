@@ -0,0 +1,37 @@
+package main
+
+const (
+	Unsubscribe = "unsubscribe"
+)
+
+// UnsubscribeEvent tells a modulator that the Node has left the Field, so
+// that it drops any routes to it.
+func UnsubscribeEvent(n Node) Event { return Event{Unsubscribe, 0.0, n, 0} }
+
+// A publisher is a Node which Broadcasts Events, which aren't part of its
+// audio stream, on the bus of the Field it's added to. Besides subscribing
+// to their types, Nodes may follow a publisher, to receive every Event it
+// publishes, whatever the type.
+type publisher interface {
+	publishTo(f *Field, as Node)
+}
+
+// A publication is designed to be embedded into publishers.
+type publication struct {
+	f  *Field
+	as Node
+}
+
+// publishTo satisfies the publisher interface. It's called when the Node
+// is added to the Field.
+func (p *publication) publishTo(f *Field, as Node) {
+	p.f, p.as = f, as
+}
+
+// publish Broadcasts the Event on behalf of the publisher. It's called on
+// the audio path, while rendering, when the Field's lock isn't held.
+func (p *publication) publish(ev Event) {
+	if p.f != nil {
+		p.f.Broadcast(p.as, ev)
+	}
+}
@@ -1,76 +1,207 @@
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 const (
-	Mod = "mod"
+	Mod      = "mod"
+	Quantize = "quantize"
 )
 
-func ModEvent(i int) Event { return Event{Mod, float32(i), nil} }
+func ModEvent(i int) Event { return Event{Mod, float32(i), nil, 0} }
+
+// QuantizeEvent sets the grid of a Node which acts on Ticks, eg. "bar", or
+// "16" for sixteenth notes.
+func QuantizeEvent(grid string) Event { return Event{Quantize + ":" + grid, 0.0, nil, 0} }
+
+// A grid is a set of the Clock's Ticks: every bar, every beat of the time
+// signature, every note of a value (a quarter note is 4), or every Tick.
+type grid int
+
+const (
+	beatGrid grid = 0
+	barGrid  grid = -1
+	tickGrid grid = -2
+)
+
+func (g grid) String() string {
+	switch g {
+	case beatGrid:
+		return "beat"
+	case barGrid:
+		return "bar"
+	case tickGrid:
+		return "tick"
+	}
+	return strconv.Itoa(int(g))
+}
+
+// parseGrid returns the grid named s.
+func parseGrid(s string) (grid, error) {
+	switch s {
+	case "beat":
+		return beatGrid, nil
+	case "bar":
+		return barGrid, nil
+	case "tick":
+		return tickGrid, nil
+	}
+	n, err := strconv.Atoi(strings.TrimRight(s, "thnds"))
+	if err != nil || !isNoteValue(n) {
+		return beatGrid, fmt.Errorf("%q isn't bar, beat, tick, or a note value from 1 to 32", s)
+	}
+	return grid(n), nil
+}
+
+// A quantizer picks out the Ticks on its grid, and of those, every mod'th:
+// counting bars from the first, beats from the first of each bar, and
+// notes and Ticks from the Clock's first Tick. Its Node follows the
+// Clock's Groove unless it's opted out, when it receives its Ticks on the
+// grid.
+type quantizer struct {
+	grid     grid
+	mod      int
+	straight bool // opted out of the Groove
+}
+
+func makeQuantizer() quantizer { return quantizer{grid: beatGrid, mod: 1} }
+
+// processEvent handles Mod, Quantize and Grooved Events, and returns false
+// for any others.
+func (q *quantizer) processEvent(ev Event) bool {
+	switch {
+	case ev.Type == Grooved:
+		q.straight = ev.Value == 0
+	case ev.Type == Mod:
+		if i := int(ev.Value); i > 0 && i <= 100 {
+			q.mod = i
+		}
+	case strings.HasPrefix(ev.Type, Quantize+":"):
+		if g, err := parseGrid(strings.TrimPrefix(ev.Type, Quantize+":")); err == nil {
+			q.grid = g
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// onGrid returns true if the Tick is one of the quantizer's.
+func (q *quantizer) onGrid(ev Event) bool {
+	i := int(ev.Value)
+	c, ok := ev.Arg.(*Clock)
+	if !ok || q.grid == tickGrid {
+		return i%q.mod == 0
+	}
+	switch q.grid {
+	case beatGrid, barGrid:
+		p := c.TickPosition(ev)
+		if p.Tick != 0 {
+			return false
+		}
+		if q.grid == beatGrid {
+			return (p.Beat-1)%q.mod == 0
+		}
+		return p.Beat == 1 && (p.Bar-1)%q.mod == 0
+	}
+	n := noteTicks(int(q.grid), c.PPQN())
+	if n <= 0 {
+		n = 1
+	}
+	return i%n == 0 && (i/n)%q.mod == 0
+}
+
+// followsGroove satisfies the grooveFollower interface.
+func (q *quantizer) followsGroove() bool { return !q.straight }
+
+func (q quantizer) String() string {
+	s := fmt.Sprintf("every %s", q.grid)
+	if q.mod > 1 {
+		s = fmt.Sprintf("every %d %s", q.mod, q.grid)
+	}
+	if q.straight {
+		s += ", straight"
+	}
+	return s
+}
 
 // A synchronizer buffers upstream Events, and releases them
-// downstream only when an appropriate Tick is received.
+// downstream only when a Tick on its grid is received. It follows the
+// Clock's Groove, moving the Events with the Tick and accenting the Notes,
+// unless it's opted out, when it releases them on the grid.
 type Synchronizer struct {
 	nodeName
 	singleAncestry
+	mailbox
+	quantizer
 
-	eventIn chan Event
-	buffer  []Event
-	mod     int
+	buffer []Event
 }
 
 func NewSynchronizer(name string) *Synchronizer {
-	s := &Synchronizer{
-		nodeName: nodeName(name),
+	return &Synchronizer{
+		nodeName:  nodeName(name),
+		quantizer: makeQuantizer(),
 
-		eventIn: make(chan Event),
-		buffer:  []Event{},
-		mod:     1,
+		buffer: []Event{},
 	}
-	go s.loop()
-	return s
 }
 
 func NewSynchronizerNode(name string) Node { return Node(NewSynchronizer(name)) }
 
+func (s *Synchronizer) String() string {
+	return fmt.Sprintf("[%s: %s, %d buffered]", NodeLabel(s), s.quantizer, len(s.buffer))
+}
+
+// accent returns the change the Groove makes to the velocity of Notes
+// released on the Tick.
+func (s *Synchronizer) accent(tick Event) float32 {
+	c, ok := tick.Arg.(*Clock)
+	if !ok || s.straight {
+		return 0
+	}
+	return c.TickVelocity(tick)
+}
+
 // Kind satisfies the Typed interface for Synchronizer.
 func (s *Synchronizer) Kind() string { return "synchronizer" }
 
-// Events satisfies the Node interface for Synchronizer.
-func (s *Synchronizer) Events() chan<- Event { return s.eventIn }
-
-func (s *Synchronizer) loop() {
-	for {
-		select {
-		case ev := <-s.eventIn:
-			switch ev.Type {
-			case Tick:
-				if int(ev.Value)%s.mod != 0 {
-					break
-				}
-				if s.ChildNode != nilNode {
-					receiver := s.ChildNode.Events()
-					for _, ev := range s.buffer {
-						receiver <- ev
-					}
-				}
-				s.buffer = []Event{}
-
-			case Mod:
-				i := int(ev.Value)
-				if i <= 0 || i > 100 {
-					D("%s: invalid Mod %.2f (%d)", s.Name(), ev.Value, i)
-					break
-				}
-				s.mod = i
+// subscriptions satisfies the busSubscriber interface for Synchronizer.
+func (s *Synchronizer) subscriptions() []string { return []string{Tick} }
 
-			case Kill:
-				return
+// buffersEvents satisfies the eventBuffer interface for Synchronizer.
+func (s *Synchronizer) buffersEvents() {}
 
-			case Connect, Disconnect, Connection, Disconnection:
-				s.singleAncestry.processEvent(ev, s)
+// processEvent satisfies the eventProcessor interface for Synchronizer.
+func (s *Synchronizer) processEvent(ev Event) {
+	if s.quantizer.processEvent(ev) {
+		return
+	}
 
-			default:
-				s.buffer = append(s.buffer, ev)
+	switch ev.Type {
+	case Tick:
+		if !s.onGrid(ev) {
+			break
+		}
+		if s.ChildNode != nilNode {
+			velocity := s.accent(ev)
+			for _, buffered := range s.buffer {
+				buffered = buffered.Timed(ev.At) // exactly on the beat
+				if buffered.Type == KeyDown && velocity != 0 {
+					buffered = accent(buffered, velocity)
+				}
+				s.ChildNode.Send(buffered)
 			}
 		}
+		s.buffer = s.buffer[:0]
+
+	case Connect, Disconnect, Connection, Disconnection, Kill:
+		s.singleAncestry.processEvent(ev, s)
+
+	default:
+		s.buffer = append(s.buffer, ev)
 	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGrid(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want grid
+		ok   bool
+	}{
+		{"beat", beatGrid, true},
+		{"bar", barGrid, true},
+		{"tick", tickGrid, true},
+		{"16", grid(16), true},
+		{"16th", grid(16), true},
+		{"8ths", grid(8), true},
+		{"2nd", grid(2), true},
+		{"1", grid(1), true},
+		{"3", beatGrid, false},
+		{"64", beatGrid, false},
+		{"0", beatGrid, false},
+		{"bars", beatGrid, false},
+	} {
+		got, err := parseGrid(tc.s)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("%s: %s, %v", tc.s, got, err)
+		}
+	}
+}
+
+func TestQuantizerGrid(t *testing.T) {
+	for _, tc := range []struct {
+		clock  *Clock // nil for Ticks without one
+		script []Event
+		ticks  int
+		want   []int
+	}{
+		{meteredClock(t, 24), nil, 192, []int{0, 24, 48, 72, 96, 120, 144, 168}},
+		{meteredClock(t, 24), []Event{ModEvent(3)}, 192, []int{0, 72, 96, 168}},
+		{meteredClock(t, 24), []Event{QuantizeEvent("bar")}, 192, []int{0, 96}},
+		{meteredClock(t, 24), []Event{QuantizeEvent("bar"), ModEvent(2)}, 384, []int{0, 192}},
+		{meteredClock(t, 24), []Event{QuantizeEvent("8")}, 48, []int{0, 12, 24, 36}},
+		{meteredClock(t, 24), []Event{QuantizeEvent("16"), ModEvent(3)}, 48, []int{0, 18, 36}},
+		{meteredClock(t, 24), []Event{QuantizeEvent("1")}, 192, []int{0, 96}},
+		{meteredClock(t, 24), []Event{QuantizeEvent("tick"), ModEvent(5)}, 16, []int{0, 5, 10, 15}},
+		{meteredClock(t, 4), []Event{QuantizeEvent("32")}, 4, []int{0, 1, 2, 3}}, // finer than a Tick
+		{meteredClock(t, 24, meterAfter{0, TimeSignature{7, 8}}), nil, 48, []int{0, 12, 24, 36}},
+		{meteredClock(t, 24, meterAfter{0, TimeSignature{7, 8}}), []Event{ModEvent(2)}, 168, []int{0, 24, 48, 72, 84, 108, 132, 156}},
+		{meteredClock(t, 24, meterAfter{0, TimeSignature{7, 8}}), []Event{QuantizeEvent("bar")}, 168, []int{0, 84}},
+		{meteredClock(t, 24, meterAfter{1, TimeSignature{3, 4}}), []Event{QuantizeEvent("bar")}, 288, []int{0, 96, 168, 240}},
+		{nil, []Event{ModEvent(4)}, 10, []int{0, 4, 8}},
+	} {
+		q := makeQuantizer()
+		for _, ev := range tc.script {
+			q.processEvent(ev)
+		}
+		var got []int
+		for i := 0; i < tc.ticks; i++ {
+			ev := Event{Tick, float32(i), nil, 0}
+			if tc.clock != nil {
+				ev = TickEvent(i, tc.clock, 0)
+			}
+			if q.onGrid(ev) {
+				got = append(got, i)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: on Ticks %v, want %v", q, got, tc.want)
+		}
+	}
+}
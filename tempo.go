@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RampEvent changes the Clock's tempo to the BPM gradually, over the
+// length, from its next Tick.
+func RampEvent(bpm float32, l RampLength) Event {
+	return Event{Ramp + ":" + l.String(), bpm, nil, 0}
+}
+
+// A TempoChange is an entry in the Clock's tempo map: from the beat, in
+// quarter notes, the tempo is the BPM. If it ramps, the tempo changes
+// evenly, beat by beat, from the one in effect at the beat, to reach the
+// BPM after Ramp quarter notes. A ramp is cut short by the next change.
+type TempoChange struct {
+	Beat float64
+	BPM  float32
+	Ramp float64 // in quarter notes; 0 jumps to the BPM
+
+	from   float32 // the tempo at the beat
+	offset float64 // frames from beat 0 to the beat
+}
+
+// String writes the TempoChange as the arguments of "tempo at".
+func (t TempoChange) String() string {
+	s := fmt.Sprintf("%g %g", t.Beat, t.BPM)
+	if t.Ramp > 0 {
+		s += fmt.Sprintf(" ramp %s", RampLength{N: t.Ramp})
+	}
+	return s
+}
+
+// tempo returns the BPM at the beat.
+func (t TempoChange) tempo(beat float64) float32 {
+	d := beat - t.Beat
+	switch {
+	case d <= 0:
+		return t.from
+	case t.Ramp <= 0 || d >= t.Ramp:
+		return t.BPM
+	}
+	return t.from + (t.BPM-t.from)*float32(d/t.Ramp)
+}
+
+// seconds returns the time from the TempoChange's beat to the beat, which
+// is negative if it's before it. Before its beat, the tempo is taken to be
+// constant.
+func (t TempoChange) seconds(beat float64) float64 {
+	d := beat - t.Beat
+	from, to := float64(t.from), float64(t.BPM)
+	switch {
+	case d <= 0:
+		return d * 60 / from
+	case t.Ramp <= 0 || from == to:
+		return d * 60 / to
+	}
+	ramp := math.Min(d, t.Ramp)
+	k := (to - from) / t.Ramp // BPM per beat
+	return 60/k*math.Log((from+k*ramp)/from) + (d-ramp)*60/to
+}
+
+// beats returns the number of quarter notes in the time from the
+// TempoChange's beat. It's the inverse of seconds.
+func (t TempoChange) beats(seconds float64) float64 {
+	from, to := float64(t.from), float64(t.BPM)
+	switch {
+	case seconds <= 0:
+		return seconds * from / 60
+	case t.Ramp <= 0 || from == to:
+		return seconds * to / 60
+	}
+	k := (to - from) / t.Ramp
+	if ramp := 60 / k * math.Log(to/from); seconds > ramp {
+		return t.Ramp + (seconds-ramp)*to/60
+	}
+	return from * (math.Exp(seconds*k/60) - 1) / k
+}
+
+// A RampLength is how long a tempo ramp lasts: a whole number of bars, as
+// counted by the time signature, or of quarter notes.
+type RampLength struct {
+	N    float64
+	Bars bool
+}
+
+func (l RampLength) String() string {
+	if l.Bars {
+		return fmt.Sprintf("%gbars", l.N)
+	}
+	return fmt.Sprintf("%gbeats", l.N)
+}
+
+// ParseRampLength parses a RampLength, written eg. 8bars, or 6beats or 6b,
+// in quarter notes. A number alone is in quarter notes.
+func ParseRampLength(s string) (RampLength, error) {
+	l := RampLength{}
+	n := s
+	switch {
+	case strings.HasSuffix(s, "bars"), strings.HasSuffix(s, "bar"):
+		n, l.Bars = strings.TrimSuffix(strings.TrimSuffix(s, "s"), "bar"), true
+	case strings.HasSuffix(s, "beats"), strings.HasSuffix(s, "beat"):
+		n = strings.TrimSuffix(strings.TrimSuffix(s, "s"), "beat")
+	case strings.HasSuffix(s, "b"):
+		n = strings.TrimSuffix(s, "b")
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) {
+		return RampLength{}, fmt.Errorf("invalid ramp length %s", s)
+	}
+	if l.Bars && v != math.Floor(v) {
+		return RampLength{}, fmt.Errorf("%s isn't a whole number of bars", s)
+	}
+	l.N = v
+	return l, nil
+}
+
+//
+//
+//
+
+// TempoMap returns the Clock's tempo map, in order.
+func (c *Clock) TempoMap() []TempoChange {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]TempoChange{}, c.tempos...)
+}
+
+// SetTempoAt adds the change to the tempo map, replacing any at its beat.
+// It can't be before the Clock's next Tick.
+func (c *Clock) SetTempoAt(t TempoChange) error {
+	if t.BPM <= 0 {
+		return fmt.Errorf("invalid BPM %g", t.BPM)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if live := c.liveBeat(); t.Beat < live {
+		return fmt.Errorf("beat %g has passed", t.Beat)
+	}
+	c.setTempo(t, false)
+	return nil
+}
+
+// LoadTempoMap replaces the tempo map, from the Clock's next Tick, with
+// the changes, which must be in order. Changes which have passed aren't
+// made, but the tempo they lead to is taken up: a ramp which is under way
+// carries on to its end. It returns how many changes had passed.
+func (c *Clock) LoadTempoMap(changes []TempoChange) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	live := c.liveBeat()
+	t := TempoChange{Beat: live, BPM: c.tempoAt(live)}
+	passed := 0
+	for _, other := range changes {
+		if other.Beat > live {
+			break
+		}
+		t.BPM, t.Ramp = other.BPM, 0
+		if end := other.Beat + other.Ramp; end > live {
+			t.Ramp = end - live
+		}
+		if other.Beat < live {
+			passed++
+		}
+	}
+	c.setTempo(t, true)
+	for _, other := range changes {
+		if other.Beat > live {
+			c.setTempo(other, false)
+		}
+	}
+	return passed
+}
+
+// RampBeats returns the length of a ramp from the beat, in quarter notes.
+func (c *Clock) RampBeats(beat float64, l RampLength) float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.rampBeats(beat, l)
+}
+
+// ClearTempoMap removes every change to come from the tempo map, holding
+// the current tempo.
+func (c *Clock) ClearTempoMap() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	live := c.liveBeat()
+	c.setTempo(TempoChange{Beat: live, BPM: c.tempoAt(live)}, true)
+}
+
+// liveBeat returns the beat from which a change to the tempo takes effect:
+// that of the last Tick broadcast, so that it and the Ticks before it keep
+// their frames. The caller must hold the lock.
+func (c *Clock) liveBeat() float64 {
+	return math.Max(0, float64(c.i-1)/float64(c.ppqn))
+}
+
+// tempoIndex returns the index of the TempoChange in effect at the beat.
+// The caller must hold the lock.
+func (c *Clock) tempoIndex(beat float64) int {
+	i := len(c.tempos) - 1
+	for i > 0 && c.tempos[i].Beat > beat {
+		i--
+	}
+	return i
+}
+
+// tempoAt returns the BPM at the beat. The caller must hold the lock.
+func (c *Clock) tempoAt(beat float64) float32 {
+	return c.tempos[c.tempoIndex(beat)].tempo(beat)
+}
+
+// rampBeats returns the length of a ramp from the beat, in quarter notes.
+// The caller must hold the lock.
+func (c *Clock) rampBeats(beat float64, l RampLength) float64 {
+	if !l.Bars {
+		return l.N
+	}
+	p := c.position(int(math.Floor(beat*float64(c.ppqn) + 0.5)))
+	p.Bar += int(l.N)
+	return c.positionBeat(p) - beat
+}
+
+// setTempo adds the change to the tempo map. A live change replaces the
+// rest of the map, as if the tempo were taken over from it; otherwise only
+// a change at the same beat is replaced. The caller must hold the lock.
+func (c *Clock) setTempo(t TempoChange, live bool) {
+	t.from = c.tempoAt(t.Beat)
+	if t.Ramp <= 0 {
+		t.Ramp, t.from = 0, t.BPM
+	}
+	tempos := make([]TempoChange, 0, len(c.tempos)+1)
+	for _, other := range c.tempos {
+		if other.Beat < t.Beat {
+			tempos = append(tempos, other)
+		}
+	}
+	tempos = append(tempos, t)
+	if !live {
+		for _, other := range c.tempos {
+			if other.Beat > t.Beat {
+				tempos = append(tempos, other)
+			}
+		}
+	}
+	c.tempos = tempos
+	c.retime()
+}
+
+// retime works out where each TempoChange falls, and so the next Tick,
+// after a change to the tempo map. The caller must hold the lock.
+func (c *Clock) retime() {
+	c.tempos[0].offset = 0
+	for i := 1; i < len(c.tempos); i++ {
+		prev, t := c.tempos[i-1], &c.tempos[i]
+		t.from = t.BPM
+		if t.Ramp > 0 {
+			t.from = prev.tempo(t.Beat)
+		}
+		t.offset = prev.offset + prev.seconds(t.Beat)*float64(config.SampleRate)
+	}
+	if c.next >= 0 {
+		c.next = c.tickFrame(c.i)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// ramp returns the TempoChange from one BPM to another over the beats.
+func ramp(at float64, from, to float32, beats float64) TempoChange {
+	return TempoChange{Beat: at, BPM: to, Ramp: beats, from: from}
+}
+
+var tempoChanges = []TempoChange{
+	ramp(0, 120, 120, 0),
+	ramp(4, 90, 90, 0),
+	ramp(0, 60, 120, 4),
+	ramp(0, 120, 60, 4),
+	ramp(8, 100, 140, 16),
+	ramp(2, 97, 97, 8),
+}
+
+func TestTempoChangeSeconds(t *testing.T) {
+	for _, tc := range []struct {
+		change  TempoChange
+		beat    float64
+		seconds float64
+	}{
+		{ramp(0, 120, 120, 0), 4, 2},
+		{ramp(0, 120, 120, 0), -1, -0.5},
+		{ramp(4, 90, 90, 0), 7, 2},
+		{ramp(0, 60, 120, 4), 4, 4 * math.Ln2},
+		{ramp(0, 60, 120, 4), 6, 4*math.Ln2 + 1},
+		{ramp(0, 60, 120, 4), 2, 4 * math.Log(1.5)},
+		{ramp(0, 60, 120, 4), -2, -2},
+		{ramp(0, 120, 60, 4), 4, 4 * math.Ln2},
+		{ramp(0, 120, 60, 4), 5, 4*math.Ln2 + 1},
+	} {
+		if got := tc.change.seconds(tc.beat); math.Abs(got-tc.seconds) > 1e-9 {
+			t.Errorf("%s from %g: beat %g after %gs, want %gs",
+				tc.change, tc.change.from, tc.beat, got, tc.seconds)
+		}
+	}
+}
+
+// The time to a beat is the integral of the length of each beat, 60/BPM,
+// at the tempo.
+func TestTempoChangeIntegral(t *testing.T) {
+	const steps = 10000
+	for _, tc := range tempoChanges {
+		for _, beat := range []float64{tc.Beat + 1, tc.Beat + tc.Ramp/2, tc.Beat + tc.Ramp + 3} {
+			sum, db := 0.0, (beat-tc.Beat)/steps
+			for i := 0; i < steps; i++ {
+				sum += 60 / float64(tc.tempo(tc.Beat+(float64(i)+0.5)*db)) * db
+			}
+			if got := tc.seconds(beat); math.Abs(got-sum) > 1e-6 {
+				t.Errorf("%s from %g: beat %g after %gs, integrated %gs", tc, tc.from, beat, got, sum)
+			}
+		}
+	}
+}
+
+func TestTempoChangeBeatsInvertsSeconds(t *testing.T) {
+	for _, tc := range tempoChanges {
+		for beat := tc.Beat - 2; beat < tc.Beat+tc.Ramp+4; beat += 0.25 {
+			s := tc.seconds(beat)
+			if got := tc.beats(s) + tc.Beat; math.Abs(got-beat) > 1e-9 {
+				t.Errorf("%s from %g: %gs to beat %g, back to beat %g", tc, tc.from, s, beat, got)
+			}
+		}
+	}
+}
+
+func TestParseRampLength(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want RampLength
+		ok   bool
+	}{
+		{"8bars", RampLength{8, true}, true},
+		{"1bar", RampLength{1, true}, true},
+		{"6beats", RampLength{6, false}, true},
+		{"1beat", RampLength{1, false}, true},
+		{"6b", RampLength{6, false}, true},
+		{"2.5", RampLength{2.5, false}, true},
+		{"1.5bars", RampLength{}, false},
+		{"0beats", RampLength{}, false},
+		{"-4", RampLength{}, false},
+		{"infbeats", RampLength{}, false},
+		{"bars", RampLength{}, false},
+	} {
+		got, err := ParseRampLength(tc.s)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("%s: %s, %v", tc.s, got, err)
+		}
+	}
+}
+
+func TestTempoMap(t *testing.T) {
+	c := meteredClock(t, 24, meterAfter{0, TimeSignature{3, 4}})
+	if err := c.SetTempoAt(TempoChange{Beat: 8, BPM: 60, Ramp: c.RampBeats(8, RampLength{2, true})}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetTempoAt(TempoChange{Beat: 20, BPM: 180}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		beat float64
+		bpm  float32
+	}{{0, 120}, {8, 120}, {11, 90}, {14, 60}, {19, 60}, {20, 180}} {
+		if got := c.tempoAt(tc.beat); math.Abs(float64(got-tc.bpm)) > 1e-3 {
+			t.Errorf("beat %g at %g BPM, want %g", tc.beat, got, tc.bpm)
+		}
+	}
+
+	start := c.Frame(0)
+	for beat := 0.0; beat < 24; beat += 1.0 / 3 {
+		frame := c.Frame(beat)
+		if got := c.Beat(frame); math.Abs(got-beat) > 1e-3 {
+			t.Errorf("beat %g at frame %d, back to beat %g", beat, frame, got)
+		}
+	}
+	for _, tc := range []struct{ beat, seconds float64 }{
+		{8, 4},
+		{14, 4 + 6*math.Ln2},
+		{20, 4 + 6*math.Ln2 + 6},
+		{23, 4 + 6*math.Ln2 + 7},
+	} {
+		got := float64(c.Frame(tc.beat)-start) / float64(config.SampleRate)
+		if math.Abs(got-tc.seconds) > 1e-4 {
+			t.Errorf("beat %g after %gs, want %gs", tc.beat, got, tc.seconds)
+		}
+	}
+}
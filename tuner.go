@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	Pitch = "pitch"
+)
+
+// A Pitch Event carries a detected frequency as its Value, and as its Arg,
+// the nearest Note, with how far the frequency is from it, in cents (see
+// DetectNote). A frequency of 0 means the pitch was lost.
+func PitchEvent(hz float32) Event {
+	return Event{Pitch, hz, DetectNote(hz), 0}
+}
+
+const (
+	tunerMinHz     = 60.0
+	tunerMaxHz     = 2000.0
+	tunerThreshold = 0.15 // of the YIN difference function
+	tunerGate      = 0.01 // RMS below which there's no pitch
+	tunerRate      = 20.0 // detections per second
+)
+
+// A Tuner is an Effect which passes its input through unchanged, and
+// detects its pitch via the YIN algorithm, tunerRate times per second, or
+// once per block if blocks are longer. Detection costs O(maxLag²), so it
+// isn't repeated every block when blocks are short. Detected pitches are
+// published as Pitch Events, so they may drive other Nodes, and can be
+// read out from the REPL.
+type Tuner struct {
+	simpleEffect
+	publication
+
+	history []float32 // most recent frames, oldest first
+	diff    []float32 // YIN difference function, by lag
+	minLag  int
+	maxLag  int
+	frames  int // since the last detection
+
+	mtx   sync.Mutex
+	pitch Event // last published; guarded by mtx
+}
+
+func NewTuner(name string) *Tuner {
+	minLag := int(float32(config.SampleRate) / tunerMaxHz)
+	maxLag := int(float32(config.SampleRate) / tunerMinHz)
+	return &Tuner{
+		simpleEffect: makeSimpleEffect(name),
+
+		history: make([]float32, 2*maxLag), // window of maxLag, plus lag
+		diff:    make([]float32, maxLag+1),
+		minLag:  minLag,
+		maxLag:  maxLag,
+		pitch:   PitchEvent(0.0),
+	}
+}
+
+func NewTunerNode(name string) Node { return Node(NewTuner(name)) }
+
+func (e *Tuner) String() string {
+	return fmt.Sprintf("[%s: %s]", NodeLabel(e), tunerReadout(e.Pitch()))
+}
+
+func (e *Tuner) Kind() string { return "Tuner" }
+
+// Hz returns the most recently detected pitch, or 0 if there's none.
+func (e *Tuner) Hz() float32 { return e.Pitch().Value }
+
+// Pitch returns the most recent Pitch Event.
+func (e *Tuner) Pitch() Event {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.pitch
+}
+
+// processAudio satisfies the audioProcessor interface. The buffer is left
+// as it is. A Pitch Event is published after every detection with a pitch,
+// and after the first without one.
+func (e *Tuner) processAudio(buf []float32) {
+	if len(buf) >= len(e.history) {
+		copy(e.history, buf[len(buf)-len(e.history):])
+	} else {
+		copy(e.history, e.history[len(buf):])
+		copy(e.history[len(e.history)-len(buf):], buf)
+	}
+
+	e.frames += len(buf)
+	period := int(float32(config.SampleRate) / tunerRate)
+	if e.frames < period {
+		return
+	}
+	e.frames %= period
+	ev := PitchEvent(e.detect())
+	e.mtx.Lock()
+	prev := e.pitch
+	e.pitch = ev
+	e.mtx.Unlock()
+	if ev.Value > 0.0 || prev.Value > 0.0 {
+		e.publish(ev)
+	}
+}
+
+// detect returns the pitch of the history, or 0 if it's too quiet or too
+// aperiodic to have one.
+//
+// http://audition.ens.fr/adc/pdf/2002_JASA_YIN.pdf
+func (e *Tuner) detect() float32 {
+	x, w := e.history, len(e.history)-e.maxLag
+
+	var sum float32 = 0.0
+	for _, v := range x[:w] {
+		sum += v * v
+	}
+	if sum/float32(w) < tunerGate*tunerGate {
+		return 0.0
+	}
+
+	// cumulative mean normalized difference
+	var running float32 = 0.0
+	e.diff[0] = 1.0
+	for lag := 1; lag <= e.maxLag; lag++ {
+		var d float32 = 0.0
+		for j := 0; j < w; j++ {
+			delta := x[j] - x[j+lag]
+			d += delta * delta
+		}
+		running += d
+		e.diff[lag] = 1.0
+		if running > 0.0 {
+			e.diff[lag] = d * float32(lag) / running
+		}
+	}
+
+	// the first dip below the threshold, followed to its minimum
+	for lag := e.minLag; lag < e.maxLag; lag++ {
+		if e.diff[lag] >= tunerThreshold {
+			continue
+		}
+		for lag+1 < e.maxLag && e.diff[lag+1] < e.diff[lag] {
+			lag++
+		}
+		a, b, c := e.diff[lag-1], e.diff[lag], e.diff[lag+1]
+		t := float32(lag)
+		if d := a - 2*b + c; d > 0.0 {
+			t += 0.5 * (a - c) / d
+		}
+		return float32(config.SampleRate) / t
+	}
+	return 0.0
+}
+
+// tunerReadout describes the Pitch Event as its nearest Note, offset in
+// cents, with a needle from -50 to +50 cents.
+func tunerReadout(ev Event) string {
+	n, ok := ev.Arg.(*detectedNote)
+	if !ok || ev.Value <= 0.0 {
+		return "no pitch"
+	}
+	const width = 21
+	gauge := []rune(strings.Repeat("─", width))
+	gauge[width/2] = '┼'
+	gauge[int((n.cents+50)/100*(width-1)+0.5)] = '┃'
+	return fmt.Sprintf("%-4s %+3.0f cents  %7.2f Hz  %s", n.Note, n.cents, ev.Value, string(gauge))
+}
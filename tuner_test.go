@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDetectNote(t *testing.T) {
+	for _, tc := range []struct {
+		hz    float32
+		str   string
+		cents float32
+	}{
+		{440.0, "A5+0c", 0},
+		{445.0, "A5+20c", 20},
+		{430.0, "A5-40c", -40},
+		{261.63, "C5+0c", 0},
+		{5.0, "C0-50c", -50}, // below the lowest note
+		{0.0, "Ø+0c", 0},
+	} {
+		n := DetectNote(tc.hz).(*detectedNote)
+		if n.String() != tc.str || n.Cents() != tc.cents {
+			t.Errorf("%.2f Hz: %s, %g cents; want %s", tc.hz, n, n.Cents(), tc.str)
+		}
+	}
+	if testing.AllocsPerRun(10, func() { DetectNote(445.0) }) > 0 {
+		t.Error("DetectNote allocates")
+	}
+}
+
+func TestTunerPublishesCents(t *testing.T) {
+	for _, hz := range []float64{110.0, 445.0, 1000.0} {
+		e := NewTuner("tu")
+		buf := make([]float32, config.BufferSize)
+		for i := 0; i < 4; i++ {
+			for j := range buf {
+				buf[j] = float32(0.5 * math.Sin(2*math.Pi*hz*float64(i*len(buf)+j)/float64(config.SampleRate)))
+			}
+			e.processAudio(buf)
+		}
+		ev := e.Pitch()
+		n, ok := ev.Arg.(*detectedNote)
+		if !ok || math.Abs(float64(ev.Value)-hz) > hz*0.005 {
+			t.Errorf("%g Hz: %s", hz, ev)
+			continue
+		}
+		want, cents := NearestNote(float32(hz))
+		if n.Note != want || math.Abs(float64(n.Cents()-cents)) > 2 {
+			t.Errorf("%g Hz: %s, want %s%+.0fc", hz, n, want, cents)
+		}
+		if r := tunerReadout(ev); !strings.HasPrefix(r, want.String()) {
+			t.Errorf("%g Hz: readout %q", hz, r)
+		}
+	}
+	if r := tunerReadout(PitchEvent(0)); r != "no pitch" {
+		t.Errorf("readout %q", r)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// RenderWAV drives the Engine from WAV files, in place of the audio device.
+// The input file (if any) is passed to the Engine as captured audio, one
+// block at a time, and the output is written to the output file (if any).
+// Blocks are rendered as fast as possible, rather than in real time.
+//
+// Rendering continues for the duration, or if that's zero, until the input
+// is exhausted. The input file must have the same sample rate as the
+// Engine.
+func (e *Engine) RenderWAV(inPath, outPath string, d time.Duration) error {
+	input := []float32{}
+	if inPath != "" {
+		buf, srate, err := loadWAV(inPath)
+		if err != nil {
+			return err
+		}
+		if srate != config.SampleRate {
+			return fmt.Errorf("%s: sample rate %d, want %d", inPath, srate, config.SampleRate)
+		}
+		input = buf
+	}
+
+	frames := len(input)
+	if d > 0 {
+		frames = int(d.Seconds()*float64(config.SampleRate) + 0.5)
+	}
+	if frames <= 0 {
+		return fmt.Errorf("nothing to render")
+	}
+
+	var w *wavWriter
+	if outPath != "" {
+		var err error
+		if w, err = createWAV(outPath, config.SampleRate); err != nil {
+			return err
+		}
+	}
+
+	out := make([]float32, config.BufferSize)
+	for i := 0; i < frames; i += config.BufferSize {
+		var in []float32
+		if i < len(input) {
+			in = input[i:]
+		}
+		e.ProcessAudio(in, out)
+		if w != nil {
+			n := frames - i
+			if n > len(out) {
+				n = len(out)
+			}
+			if err := w.write(out[:n]); err != nil {
+				w.close()
+				return err
+			}
+		}
+	}
+	D("rendered %d frames", frames)
+
+	if w != nil {
+		return w.close()
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// wavPatch returns an Engine for a Field built from the script.
+func wavPatch(t *testing.T, script string) *Engine {
+	f := NewField()
+	m := NewMixer()
+	f.Add(m)
+	f.Add(NewClock(f))
+	e := NewEngine(f, m)
+	o := &recordingOutput{}
+	NewFieldParser(f, e, o).Parse(script)
+	if o.err != nil {
+		t.Fatal(o.err)
+	}
+	return e
+}
+
+// wavTolerance is the error of a sample written to a WAV file and read back.
+const wavTolerance = 2.0 / 32767
+
+func TestRenderWAV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.wav")
+
+	const script = "add sine a; a -> mixer; a4 -> a"
+	frames := 2*config.BufferSize + config.BufferSize/2
+	d := time.Duration(frames) * config.SampleDuration()
+	if err := wavPatch(t, script).RenderWAV("", path, d); err != nil {
+		t.Fatal(err)
+	}
+
+	got, srate, err := loadWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srate != config.SampleRate {
+		t.Errorf("sample rate %d, want %d", srate, config.SampleRate)
+	}
+	if len(got) != frames {
+		t.Fatalf("%d frames, want %d", len(got), frames)
+	}
+
+	// The same patch, rendered block by block, must sound the same.
+	e := wavPatch(t, script)
+	want := []float32{}
+	out := make([]float32, config.BufferSize)
+	for len(want) < frames {
+		e.ProcessAudio(nil, out)
+		want = append(want, out...)
+	}
+	loud := false
+	for i, v := range got {
+		if math.Abs(float64(v-want[i])) > wavTolerance {
+			t.Fatalf("frame %d: %g, want %g", i, v, want[i])
+		}
+		loud = loud || math.Abs(float64(v)) > 0.05
+	}
+	if !loud {
+		t.Error("rendered silence")
+	}
+}
+
+func TestRenderWAVInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inPath, outPath := filepath.Join(dir, "in.wav"), filepath.Join(dir, "out.wav")
+
+	in := make([]float32, 3*config.BufferSize-100)
+	for i := range in {
+		in[i] = float32(math.Sin(float64(i) / 10))
+	}
+	w, err := createWAV(inPath, config.SampleRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.write(in); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// With no duration, rendering lasts as long as the input, which passes
+	// through the Mixer at its gain.
+	if err := wavPatch(t, "add input i; i -> mixer").RenderWAV(inPath, outPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := loadWAV(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(in) {
+		t.Fatalf("%d frames, want %d", len(got), len(in))
+	}
+	for i, v := range got {
+		if want := 0.1 * in[i]; math.Abs(float64(v-want)) > wavTolerance {
+			t.Fatalf("frame %d: %g, want %g", i, v, want)
+		}
+	}
+
+	if err := wavPatch(t, "").RenderWAV("", outPath, 0); err == nil {
+		t.Error("rendered nothing without error")
+	}
+}
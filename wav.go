@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const wavHeaderSize = 44
+
+// A wavWriter writes mono, 16-bit PCM audio data to a WAV file.
+// The file isn't valid until it's closed.
+type wavWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	srate   int
+	frames  int
+	scratch []byte
+}
+
+func createWAV(path string, srate int) (*wavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &wavWriter{
+		file:  file,
+		w:     bufio.NewWriter(file),
+		srate: srate,
+	}
+	if err := w.header(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// header writes the WAV header, describing however many frames have been
+// written so far.
+func (w *wavWriter) header() error {
+	const (
+		channels = 1
+		bytesPer = 2
+	)
+	dataSize := uint32(w.frames * channels * bytesPer)
+	fields := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(wavHeaderSize - 8 + dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16), // fmt chunk size
+		uint16(1),  // PCM
+		uint16(channels),
+		uint32(w.srate),
+		uint32(w.srate * channels * bytesPer), // byte rate
+		uint16(channels * bytesPer),           // block align
+		uint16(8 * bytesPer),                  // bits per sample
+		[4]byte{'d', 'a', 't', 'a'},
+		dataSize,
+	}
+	for _, field := range fields {
+		if err := binary.Write(w.w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends the buffer to the file. Values outside [-1 .. 1] are
+// clipped.
+func (w *wavWriter) write(buf []float32) error {
+	if len(w.scratch) < 2*len(buf) {
+		w.scratch = make([]byte, 2*len(buf))
+	}
+	for i, v := range buf {
+		if v > 1.0 {
+			v = 1.0
+		} else if v < -1.0 {
+			v = -1.0
+		}
+		binary.LittleEndian.PutUint16(w.scratch[2*i:], uint16(int16(v*32767)))
+	}
+	if _, err := w.w.Write(w.scratch[:2*len(buf)]); err != nil {
+		return err
+	}
+	w.frames += len(buf)
+	return nil
+}
+
+// close flushes all written data, and rewrites the header to describe it.
+func (w *wavWriter) close() error {
+	defer w.file.Close()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, 0); err != nil {
+		return err
+	}
+	w.w.Reset(w.file)
+	if err := w.header(); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// loadWAV reads all of the audio data from a 16-bit PCM WAV file. If there's
+// more than one channel, only the first is returned.
+func loadWAV(path string) ([]float32, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Wave [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return nil, 0, err
+	}
+	if string(riff.ID[:]) != "RIFF" || string(riff.Wave[:]) != "WAVE" {
+		return nil, 0, fmt.Errorf("%s: not a WAV file", path)
+	}
+
+	var format struct {
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return nil, 0, fmt.Errorf("%s: no data: %s", path, err)
+		}
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			if err := binary.Read(r, binary.LittleEndian, &format); err != nil {
+				return nil, 0, err
+			}
+			if format.Format != 1 || format.BitsPerSample != 16 || format.Channels < 1 {
+				return nil, 0, fmt.Errorf("%s: only 16-bit PCM is supported", path)
+			}
+			if _, err := r.Discard(int(chunk.Size) - 16); err != nil {
+				return nil, 0, err
+			}
+
+		case "data":
+			if format.Channels < 1 {
+				return nil, 0, fmt.Errorf("%s: data before fmt", path)
+			}
+			raw := make([]int16, int(chunk.Size)/2)
+			if err := binary.Read(r, binary.LittleEndian, raw); err != nil {
+				return nil, 0, err
+			}
+			channels := int(format.Channels)
+			buf := make([]float32, len(raw)/channels)
+			for i := range buf {
+				buf[i] = float32(raw[i*channels]) / 32767
+			}
+			return buf, int(format.SampleRate), nil
+
+		default:
+			if _, err := r.Discard(int(chunk.Size + chunk.Size%2)); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+}